@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/tps193/balcony-stargazer/internal/ephemeris"
+	"github.com/tps193/balcony-stargazer/internal/visibility"
+)
+
+func runCalendar(s []string) {
+	calendarCmd := flag.NewFlagSet("calendar", flag.ExitOnError)
+	configFile := calendarCmd.String("configfile", "", "Path to the configuration file")
+	configStr := calendarCmd.String("configstr", "", "String with configurations in JSON format")
+
+	objectFile := calendarCmd.String("objectfile", "", "Path to the object file")
+	objectStr := calendarCmd.String("objectstr", "", "String with objects in JSON format")
+
+	year := calendarCmd.Int("year", time.Now().Year(), "Year to plan")
+	darkness := calendarCmd.String("darkness", string(ephemeris.DarknessAstronomical), "Darkness level: civil, nautical or astronomical")
+	maxAirmass := calendarCmd.Float64("maxairmass", 0, "Maximum airmass, e.g. 2 for 30° altitude (0 for no limit)")
+	format := calendarCmd.String("format", "text", "Output format: text, csv or svg")
+	output := calendarCmd.String("output", "", "Path to write the calendar to instead of the standard output")
+
+	logfile := calendarCmd.String("logfile", "", "Path to the log file")
+	logLevel := calendarCmd.String("loglevel", "info", "Log level: debug, info, warn or error")
+
+	calendarCmd.Parse(s)
+
+	f := initLogging(logfile, logLevel)
+	if f != nil {
+		defer f.Close()
+	}
+
+	config, err := parseConfig(configFile, configStr)
+	if err != nil {
+		fmt.Println("Error loading configuration:", err)
+		return
+	}
+
+	astroObjectValue, err := readFlag(objectFile, objectStr, "astronomical object")
+	if err != nil {
+		fmt.Println("Error reading astronomical object:", err)
+		return
+	}
+	var objectsArray visibility.AstroObjectArray
+	if err := json.Unmarshal([]byte(astroObjectValue), &objectsArray); err != nil {
+		fmt.Println("Error parsing json:", err)
+		return
+	}
+
+	level, err := ephemeris.ParseDarkness(*darkness)
+	if err != nil {
+		fmt.Println("Error parsing darkness:", err)
+		return
+	}
+
+	calendars, err := visibility.CalculateCalendars(&objectsArray, config, *year, level, visibility.Filter{MaxVignettingPercent: visibility.DefaultMaxVignettingPercent, MaxAirmass: *maxAirmass})
+	if err != nil {
+		fmt.Println("Error calculating calendar:", err)
+		return
+	}
+
+	var res string
+	switch *format {
+	case "text":
+		res = visibility.NewSimpleOutputResult().GetCalendars(calendars)
+	case "csv":
+		res, err = visibility.CalendarCSV(calendars)
+		if err != nil {
+			fmt.Println("Error writing csv:", err)
+			return
+		}
+	case "svg":
+		res = visibility.CalendarSVG(calendars)
+	default:
+		fmt.Println("Error: unknown format", *format)
+		return
+	}
+
+	if *output == "" {
+		fmt.Print(res)
+		return
+	}
+	if err := os.WriteFile(*output, []byte(res), 0o644); err != nil {
+		fmt.Println("Error writing calendar:", err)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/tps193/balcony-stargazer/internal/visibility"
+)
+
+const defaultJournal = "journal.json"
+
+func runJournal(s []string) {
+	journalCmd := flag.NewFlagSet("journal", flag.ExitOnError)
+	file := journalCmd.String("file", defaultJournal, "Path to the journal file")
+	object := journalCmd.String("object", "", "Object imaged; records a session when given")
+	start := journalCmd.String("start", "", "Start of the session in RFC3339 format (default: now)")
+	minutes := journalCmd.Float64("minutes", 0, "Integration time of the session in minutes")
+	config := journalCmd.String("config", "", "Setup used, e.g. the site or mount name")
+	filter := journalCmd.String("filter", "", "Filter used")
+	notes := journalCmd.String("notes", "", "Notes on the session")
+
+	logfile := journalCmd.String("logfile", "", "Path to the log file")
+	logLevel := journalCmd.String("loglevel", "info", "Log level: debug, info, warn or error")
+
+	journalCmd.Parse(s)
+
+	f := initLogging(logfile, logLevel)
+	if f != nil {
+		defer f.Close()
+	}
+
+	journal, err := visibility.LoadJournal(*file)
+	if err != nil {
+		fmt.Println("Error loading journal:", err)
+		return
+	}
+
+	if *object != "" {
+		startTime := time.Now()
+		if *start != "" {
+			startTime, err = time.Parse(time.RFC3339, *start)
+			if err != nil {
+				fmt.Println("Error parsing start time:", err)
+				return
+			}
+		}
+		entry := visibility.JournalEntry{Object: *object, StartTime: startTime, Minutes: *minutes, Config: *config, Filter: *filter, Notes: *notes}
+		if err := journal.Add(entry); err != nil {
+			fmt.Println("Error recording session:", err)
+			return
+		}
+		if err := journal.Save(*file); err != nil {
+			fmt.Println("Error saving journal:", err)
+			return
+		}
+		fmt.Printf("Recorded %s of %s\n", time.Duration(*minutes*float64(time.Minute)), *object)
+	}
+
+	summaries := journal.Summaries()
+	names := make([]string, 0, len(summaries))
+	for name := range summaries {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return summaries[names[i]].Total > summaries[names[j]].Total
+	})
+	for _, name := range names {
+		summary := summaries[name]
+		fmt.Printf("%s: %s in %d sessions, last on %s\n", name, summary.Total, summary.Sessions, summary.Last.Format(time.DateOnly))
+	}
+}
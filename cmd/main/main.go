@@ -5,20 +5,24 @@ import (
 	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"math"
 	"os"
 	"time"
 
 	"github.com/tps193/balcony-stargazer/internal/database"
+	"github.com/tps193/balcony-stargazer/internal/ephemeris"
+	"github.com/tps193/balcony-stargazer/internal/logging"
 	"github.com/tps193/balcony-stargazer/internal/visibility"
 )
 
+var logger = logging.New("cli")
+
 func main() {
 	// logFile := initLogging()
 	// defer logFile.Close()
 
 	if len(os.Args) < 2 {
-		fmt.Println("Expected 'observe' or 'suggest' subcommand")
+		fmt.Println("Expected 'observe', 'suggest', 'calendar', 'projects', 'journal', 'near' or 'cache' subcommand")
 		os.Exit(1)
 	}
 	switch os.Args[1] {
@@ -26,8 +30,18 @@ func main() {
 		runObserve(os.Args[2:])
 	case "suggest":
 		runSuggest(os.Args[2:])
+	case "calendar":
+		runCalendar(os.Args[2:])
+	case "projects":
+		runProjects(os.Args[2:])
+	case "journal":
+		runJournal(os.Args[2:])
+	case "near":
+		runNear(os.Args[2:])
+	case "cache":
+		runCache(os.Args[2:])
 	default:
-		fmt.Println("expected 'observe' or 'suggest' subcommands")
+		fmt.Println("expected 'observe', 'suggest', 'calendar', 'projects', 'journal', 'near' or 'cache' subcommands")
 		os.Exit(1)
 	}
 
@@ -40,6 +54,18 @@ func runSuggest(s []string) {
 	configStr := suggestCmd.String("configstr", "", "String with configurations in JSON format")
 
 	minVisibilityMin := suggestCmd.Int("minvisibilitytime", 0, "Minimum visibility duration in minutes")
+	maxVignetting := suggestCmd.Float64("maxvignetting", visibility.DefaultMaxVignettingPercent, "Maximum vignetted part of the aperture in percent (0 for none, 100 to accept any partial vignetting)")
+	maxAirmass := suggestCmd.Float64("maxairmass", 0, "Maximum airmass, e.g. 2 for 30° altitude (0 for no limit)")
+	band := suggestCmd.String("band", "", "Photometric band to report atmospheric extinction in: U, B, V, R or I")
+	minClear := suggestCmd.Float64("minclear", 0, "Minimum unobstructed part of an extended object in percent (0 checks only the center)")
+	clearFrame := suggestCmd.Bool("clearframe", false, "Check the unobstructed part of the equipment frame instead of the object (requires -equipment)")
+	rotation := registerFieldRotationFlags(suggestCmd)
+	framing := registerFramingFlags(suggestCmd)
+	moon := registerMoonFlags(suggestCmd)
+	sky := suggestCmd.Bool("sky", false, "Report the estimated sky background for every window")
+	surfBrMargin := suggestCmd.Float64("surfbrmargin", math.NaN(), "Skip objects whose surface brightness is more than this many mag/arcsec² fainter than the darkest sky of their windows")
+	minFill := suggestCmd.Float64("minfill", 0, "Minimum part of the frame the object fills, e.g. 0.3 (requires -equipment)")
+	maxFill := suggestCmd.Float64("maxfill", 0, "Maximum part of the frame the object fills, 1 to skip objects needing a mosaic (requires -equipment)")
 
 	minSize := suggestCmd.Float64("minsize", -1.0, "Minimum size in arc minutes")
 	maxSize := suggestCmd.Float64("maxsize", -1.0, "Maximum size in arc minutes")
@@ -47,28 +73,42 @@ func runSuggest(s []string) {
 	minMagnitude := suggestCmd.Float64("minmagnitude", -1.0, "Minimum magnitude")
 	maxMagnitude := suggestCmd.Float64("maxmagnitude", -1.0, "Maximum magnitude")
 
+	journalFile := suggestCmd.String("journal", "", "Path to the journal file of past sessions")
+	exposureGoal := suggestCmd.Float64("exposuregoal", 10, "Hours in the journal after which an object counts as complete; less imaged objects score higher")
+	skipCompleted := suggestCmd.Bool("skipcompleted", false, "Skip objects completed according to the journal (requires -journal)")
+	top := suggestCmd.Int("top", 0, "Number of best scoring objects to print per page (0 prints all)")
+	page := suggestCmd.Int("page", 1, "Page of -top objects to print, starting at 1")
+
+	catalog := suggestCmd.String("catalog", database.DefaultCatalog, "Comma separated paths to the catalog CSV files")
+
 	//TODO: make proper descriptions and add help
 	timeFile := suggestCmd.String("timefile", "", "Path to the time file in RFC3339 format (e.g., 2024-06-30T22:30:00Z)")
 	timeString := suggestCmd.String("timestr", "", "String with observation time windows in RFC3339 format (e.g., 2025-07-01T05:30:00Z)")
+	night := registerNightFlags(suggestCmd)
 
 	logfile := suggestCmd.String("logfile", "", "Path to the log file")
+	logLevel := suggestCmd.String("loglevel", "info", "Log level: debug, info, warn or error")
 
 	suggestCmd.Parse(s)
+	if *exposureGoal <= 0 {
+		fmt.Println("Error: -exposuregoal must be positive")
+		return
+	}
 
-	f := initLogging(logfile)
+	f := initLogging(logfile, logLevel)
 	if f != nil {
 		defer f.Close()
 	}
 
-	timeRanges, err := parseTime(timeFile, timeString)
+	config, err := parseConfig(configFile, configStr)
 	if err != nil {
-		fmt.Println("Error parsing time range:", err)
+		fmt.Println("Error loading configuration:", err)
 		return
 	}
 
-	config, err := parseConfig(configFile, configStr)
+	timeRanges, err := night.timeRanges(config, timeFile, timeString)
 	if err != nil {
-		fmt.Println("Error loading configuration:", err)
+		fmt.Println("Error parsing time range:", err)
 		return
 	}
 
@@ -80,8 +120,7 @@ func runSuggest(s []string) {
 		ObjectType:        observationType,
 	}
 
-	//copilot put paths to catalog files
-	catalogObjects, err := database.ParseCatalogCSV(filter, "/Users/sergey/Programming/GoProjects/balconyStargazer/database/NGC_with_common_names.csv")
+	catalogObjects, err := database.ParseCatalogFiles(filter, database.CatalogPaths(*catalog)...)
 	if err != nil {
 		fmt.Println("Error parsing catalog CSV:", err)
 		return
@@ -93,8 +132,69 @@ func runSuggest(s []string) {
 		return
 	}
 
-	visibilityInfos := visibility.CalculateAltitudeVisibility(astroObjects, config, timeRanges, 5, visibility.Filter{MinVisibilityDurationMinutes: *minVisibilityMin}, true)
-	fmt.Println(visibility.NewSimpleOutputResult().Get(&visibilityInfos))
+	framingOptions, err := framing.options(config)
+	if err != nil {
+		fmt.Println("Error loading equipment:", err)
+		return
+	}
+	if framingOptions.Equipment != nil {
+		framingOptions.MinFill = *minFill
+		framingOptions.MaxFill = *maxFill
+		astroObjects = visibility.FilterByFraming(astroObjects, framingOptions)
+	}
+	var journal *visibility.JournalIndex
+	if *journalFile != "" {
+		loaded, err := visibility.LoadJournal(*journalFile)
+		if err != nil {
+			fmt.Println("Error loading journal:", err)
+			return
+		}
+		journal = loaded.Index(catalogObjects)
+		if *skipCompleted {
+			astroObjects = journal.FilterCompleted(astroObjects, time.Duration(*exposureGoal*float64(time.Hour)))
+		}
+	}
+	astroObjects, mosaics, err := framing.splitMosaics(astroObjects, framingOptions)
+	if err != nil {
+		fmt.Println("Error planning mosaics:", err)
+		return
+	}
+
+	visibilityFilter := visibility.Filter{MinVisibilityDurationMinutes: *minVisibilityMin, MaxVignettingPercent: *maxVignetting, MinClearPercent: *minClear, MaxAirmass: *maxAirmass}
+	if *clearFrame {
+		visibilityFilter.Frame = &framingOptions
+	}
+	visibilityFilter.MoonAvoidance = moon.avoidance()
+	visibilityInfos := visibility.CalculateAltitudeVisibility(astroObjects, config, timeRanges, 5, visibilityFilter, true)
+	framing.analyze(visibilityInfos, framingOptions)
+	rotation.analyze(visibilityInfos, config, framingOptions.Equipment)
+	moon.analyze(visibilityInfos, config)
+	if *band != "" {
+		if err := visibility.AnalyzeExtinction(visibilityInfos, *band); err != nil {
+			fmt.Println("Error computing extinction:", err)
+			return
+		}
+	}
+	if (*sky || !math.IsNaN(*surfBrMargin)) && len(config.Configs) > 0 {
+		visibility.AnalyzeSkyBrightness(visibilityInfos, config)
+	}
+	if !math.IsNaN(*surfBrMargin) {
+		visibilityInfos = visibility.FilterBySurfaceBrightness(visibilityInfos, *surfBrMargin)
+	}
+	scoreOptions := config.ScoreOptions(framingOptions)
+	if journal != nil {
+		visibility.AnalyzeJournal(visibilityInfos, journal)
+		scoreOptions.Journal = journal
+		scoreOptions.ExposureGoal = time.Duration(*exposureGoal * float64(time.Hour))
+	}
+	visibility.RankByScore(visibilityInfos, timeRanges, scoreOptions)
+	if *top > 0 {
+		total := len(visibilityInfos)
+		visibilityInfos = visibility.Paginate(visibilityInfos, *top, *page)
+		fmt.Printf("Page %d of %d (%d objects)\n", max(*page, 1), (total+*top-1)/(*top), total)
+	}
+	night.print(visibilityInfos, timeRanges)
+	printMosaics(visibility.CalculateMosaicVisibility(mosaics, config, timeRanges, 5, visibilityFilter, true))
 }
 
 func runObserve(s []string) {
@@ -108,14 +208,30 @@ func runObserve(s []string) {
 	//TODO: make proper descriptions and add help
 	timeFile := observeCmd.String("timefile", "", "Path to the time file in RFC3339 format (e.g., 2024-06-30T22:30:00Z)")
 	timeString := observeCmd.String("timestr", "", "String with observation time windows in RFC3339 format (e.g., 2025-07-01T05:30:00Z)")
+	night := registerNightFlags(observeCmd)
 
 	minVisibilityMin := observeCmd.Int("minvisibilitytime", 0, "Minimum visibility duration in minutes")
+	maxVignetting := observeCmd.Float64("maxvignetting", visibility.DefaultMaxVignettingPercent, "Maximum vignetted part of the aperture in percent (0 for none, 100 to accept any partial vignetting)")
+	maxAirmass := observeCmd.Float64("maxairmass", 0, "Maximum airmass, e.g. 2 for 30° altitude (0 for no limit)")
+	band := observeCmd.String("band", "", "Photometric band to report atmospheric extinction in: U, B, V, R or I")
+	minClear := observeCmd.Float64("minclear", 0, "Minimum unobstructed part of an extended object in percent (0 checks only the center)")
+	clearFrame := observeCmd.Bool("clearframe", false, "Check the unobstructed part of the equipment frame instead of the object (requires -equipment)")
+	rotation := registerFieldRotationFlags(observeCmd)
+	framing := registerFramingFlags(observeCmd)
+	moon := registerMoonFlags(observeCmd)
+	sky := observeCmd.Bool("sky", false, "Report the estimated sky background for every window")
+	schedule := observeCmd.Bool("schedule", false, "Sequence the objects into a timeline for every night instead of listing their windows")
+	journalFile := observeCmd.String("journal", "", "Path to the journal file; shows the time imaged in past sessions")
+	catalog := observeCmd.String("catalog", database.DefaultCatalog, "Comma separated paths to the catalog CSV files, used to match -journal sessions by Messier number and common name")
+	minBlock := observeCmd.Int("minblock", 30, "Shortest imaging block in minutes for -schedule")
+	overhead := observeCmd.Int("overhead", 5, "Slew and framing time in minutes before every block for -schedule")
 
 	logfile := observeCmd.String("logfile", "", "Path to the log file")
+	logLevel := observeCmd.String("loglevel", "info", "Log level: debug, info, warn or error")
 
 	observeCmd.Parse(s)
 
-	f := initLogging(logfile)
+	f := initLogging(logfile, logLevel)
 	if f != nil {
 		defer f.Close()
 	}
@@ -126,6 +242,12 @@ func runObserve(s []string) {
 		return
 	}
 
+	framingOptions, err := framing.options(config)
+	if err != nil {
+		fmt.Println("Error loading equipment:", err)
+		return
+	}
+
 	astroObjectValue, err := readFlag(objectFile, objectStr, "astronomical object")
 	if err != nil {
 		fmt.Println("Error reading astronomical object:", err)
@@ -138,17 +260,80 @@ func runObserve(s []string) {
 		return
 	}
 
-	timeRanges, err := parseTime(timeFile, timeString)
+	timeRanges, err := night.timeRanges(config, timeFile, timeString)
 	if err != nil {
 		fmt.Println("Error parsing time range:", err)
 		return
 	}
 
-	log.Println(config)
-	log.Println(objectsArray)
+	logger.Debug("observe input", "config", config, "objects", objectsArray)
 
-	visibilityInfos := visibility.CalculateAltitudeVisibility(&objectsArray, config, timeRanges, 5, visibility.Filter{MinVisibilityDurationMinutes: *minVisibilityMin}, true)
-	fmt.Println(visibility.NewSimpleOutputResult().Get(&visibilityInfos))
+	astroObjects, mosaics, err := framing.splitMosaics(&objectsArray, framingOptions)
+	if err != nil {
+		fmt.Println("Error planning mosaics:", err)
+		return
+	}
+
+	visibilityFilter := visibility.Filter{MinVisibilityDurationMinutes: *minVisibilityMin, MaxVignettingPercent: *maxVignetting, MinClearPercent: *minClear, MaxAirmass: *maxAirmass}
+	if *clearFrame {
+		visibilityFilter.Frame = &framingOptions
+	}
+	visibilityFilter.MoonAvoidance = moon.avoidance()
+	visibilityInfos := visibility.CalculateAltitudeVisibility(astroObjects, config, timeRanges, 5, visibilityFilter, true)
+	framing.analyze(visibilityInfos, framingOptions)
+	rotation.analyze(visibilityInfos, config, framingOptions.Equipment)
+	moon.analyze(visibilityInfos, config)
+	if *band != "" {
+		if err := visibility.AnalyzeExtinction(visibilityInfos, *band); err != nil {
+			fmt.Println("Error computing extinction:", err)
+			return
+		}
+	}
+	if *sky && len(config.Configs) > 0 {
+		visibility.AnalyzeSkyBrightness(visibilityInfos, config)
+	}
+	if *journalFile != "" {
+		journal, err := visibility.LoadJournal(*journalFile)
+		if err != nil {
+			fmt.Println("Error loading journal:", err)
+			return
+		}
+		rows, err := database.ParseCatalogFiles(database.Filter{}, database.CatalogPaths(*catalog)...)
+		if err != nil {
+			fmt.Println("Error parsing catalog CSV:", err)
+			return
+		}
+		visibility.AnalyzeJournal(visibilityInfos, journal.Index(rows))
+	}
+	if *schedule {
+		options := visibility.ScheduleOptions{
+			MinBlock:   time.Duration(*minBlock) * time.Minute,
+			Overhead:   time.Duration(*overhead) * time.Minute,
+			Priorities: config.Priorities,
+		}
+		if err := options.Validate(); err != nil {
+			fmt.Println("Error in schedule options:", err)
+			return
+		}
+		fmt.Println(visibility.NewSimpleOutputResult().GetSchedules(visibility.ScheduleNights(visibilityInfos, timeRanges, options)))
+		return
+	}
+	night.print(visibilityInfos, timeRanges)
+	printMosaics(visibility.CalculateMosaicVisibility(mosaics, config, timeRanges, 5, visibilityFilter, false))
+}
+
+func runCache(s []string) {
+	cacheCmd := flag.NewFlagSet("cache", flag.ExitOnError)
+	catalog := cacheCmd.String("catalog", database.DefaultCatalog, "Comma separated paths to the catalog CSV files")
+	cacheCmd.Parse(s)
+
+	for _, path := range database.CatalogPaths(*catalog) {
+		if err := database.BuildCatalogCache(path); err != nil {
+			fmt.Println("Error building catalog cache:", err)
+			return
+		}
+		fmt.Printf("Compiled %s to %s%s\n", path, path, database.CacheSuffix)
+	}
 }
 
 func parseConfig(configFile, configStr *string) (*visibility.ConfigArray, error) {
@@ -161,10 +346,23 @@ func parseConfig(configFile, configStr *string) (*visibility.ConfigArray, error)
 	if err != nil {
 		return nil, fmt.Errorf("Error parsing configuration: %w", err)
 	}
+	if err := config.ResolveMounts(); err != nil {
+		return nil, fmt.Errorf("Error resolving mount profiles: %w", err)
+	}
+	if err := config.ResolveSites(); err != nil {
+		return nil, fmt.Errorf("Error resolving sites: %w", err)
+	}
+	if config.Scoring != nil {
+		if err := config.Scoring.Validate(); err != nil {
+			return nil, fmt.Errorf("Error in scoring: %w", err)
+		}
+	}
 	return &config, nil
 }
 
-func parseTime(timeFile, timeStr *string) ([]visibility.TimeRange, error) {
+// parseTime reads the time ranges. Times without an offset are taken in the
+// given site time zone.
+func parseTime(timeFile, timeStr *string, location *time.Location) ([]visibility.TimeRange, error) {
 	if timeFile == nil && timeStr == nil {
 		return nil, errors.New("time value is required")
 	}
@@ -195,11 +393,11 @@ func parseTime(timeFile, timeStr *string) ([]visibility.TimeRange, error) {
 		return nil, errors.New("no valid time range found")
 	} else {
 		for _, tr := range timeRangesJson {
-			startTime, err := time.Parse(time.RFC3339, tr.StartTime)
+			startTime, err := visibility.ParseTime(tr.StartTime, location)
 			if err != nil {
 				return nil, fmt.Errorf("error parsing start time: %w", err)
 			}
-			endTime, err := time.Parse(time.RFC3339, tr.EndTime)
+			endTime, err := visibility.ParseTime(tr.EndTime, location)
 			if err != nil {
 				return nil, fmt.Errorf("error parsing end time: %w", err)
 			}
@@ -231,16 +429,221 @@ func readFlag(fileValue, strValue *string, name string) (string, error) {
 	return result, nil
 }
 
-func initLogging(logfile *string) *os.File {
+func initLogging(logfile, logLevel *string) *os.File {
+	level, err := logging.ParseLevel(*logLevel)
+	if err != nil {
+		fmt.Println("Error parsing log level:", err)
+	} else {
+		logging.SetLevel(level)
+	}
 	if *logfile != "" {
 		f, err := os.OpenFile(*logfile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 		if err != nil {
 			fmt.Println("Error opening log file:", err)
 			return nil
 		}
-		log.SetOutput(f)
+		logging.SetOutput(f)
 		return f
 	} else {
 		return nil
 	}
 }
+
+type fieldRotationFlags struct {
+	sensorWidth  *int
+	sensorHeight *int
+	tolerance    *float64
+	subExposure  *float64
+}
+
+func registerFieldRotationFlags(fs *flag.FlagSet) *fieldRotationFlags {
+	return &fieldRotationFlags{
+		sensorWidth:  fs.Int("sensorwidth", 0, "Sensor width in pixels; enables field rotation analysis for alt-az mounts"),
+		sensorHeight: fs.Int("sensorheight", 0, "Sensor height in pixels"),
+		tolerance:    fs.Float64("trailtolerance", 1.0, "Acceptable field rotation trail at the sensor corner in pixels"),
+		subExposure:  fs.Float64("subexposure", 0, "Planned sub-exposure in seconds; periods with too much field rotation for it are reported"),
+	}
+}
+
+// analyze runs the field rotation analysis when a sensor size is given on the
+// command line or by the equipment profile
+func (f *fieldRotationFlags) analyze(infos []visibility.VisibilityInfo, config *visibility.ConfigArray, equipment *visibility.EquipmentProfile) {
+	width, height := *f.sensorWidth, *f.sensorHeight
+	if width <= 0 && equipment != nil {
+		width, height = equipment.SensorWidthPx, equipment.SensorHeightPx
+	}
+	if width <= 0 || len(config.Configs) == 0 {
+		return
+	}
+	visibility.AnalyzeFieldRotation(infos, config, visibility.FieldRotationOptions{
+		SensorWidthPx:  width,
+		SensorHeightPx: height,
+		TolerancePx:    *f.tolerance,
+		SubExposure:    time.Duration(*f.subExposure * float64(time.Second)),
+	})
+}
+
+type framingFlags struct {
+	equipment *string
+	rotation  *float64
+	mosaic    *bool
+	overlap   *float64
+}
+
+func registerFramingFlags(fs *flag.FlagSet) *framingFlags {
+	return &framingFlags{
+		equipment: fs.String("equipment", "", "Equipment profile for framing checks: vespera-ii, seestar-s50, dwarf-3 or a profile declared in the config"),
+		rotation:  fs.Float64("framerotation", 0, "Position angle of the frame's up direction in degrees, 0 for north up"),
+		mosaic:    fs.Bool("mosaic", false, "Plan mosaic panels for objects larger than the frame and report each panel's visibility (requires -equipment)"),
+		overlap:   fs.Float64("overlap", visibility.DefaultMosaicOverlap, "Overlap of neighboring mosaic panels as a fraction of the frame, at least 0 and less than 1"),
+	}
+}
+
+// splitMosaics takes the objects needing a mosaic out of the objects when
+// mosaic planning is enabled
+func (f *framingFlags) splitMosaics(objects *visibility.AstroObjectArray, options visibility.FramingOptions) (*visibility.AstroObjectArray, []visibility.Mosaic, error) {
+	if !*f.mosaic || options.Equipment == nil {
+		return objects, nil, nil
+	}
+	return visibility.SplitMosaics(objects, options, *f.overlap)
+}
+
+func (f *framingFlags) options(config *visibility.ConfigArray) (visibility.FramingOptions, error) {
+	options := visibility.FramingOptions{Rotation: *f.rotation}
+	if *f.equipment == "" {
+		return options, nil
+	}
+	equipment, err := config.FindEquipment(*f.equipment)
+	if err != nil {
+		return options, err
+	}
+	options.Equipment = equipment
+	return options, nil
+}
+
+func (f *framingFlags) analyze(infos []visibility.VisibilityInfo, options visibility.FramingOptions) {
+	if options.Equipment == nil {
+		return
+	}
+	visibility.AnalyzeFraming(infos, options)
+}
+
+func printMosaics(mosaics []visibility.Mosaic) {
+	if len(mosaics) == 0 {
+		return
+	}
+	fmt.Println(visibility.NewSimpleOutputResult().GetMosaics(mosaics))
+}
+
+type nightFlags struct {
+	date       *string
+	endDate    *string
+	nights     *int
+	darkness   *string
+	byNight    *bool
+	bestNights *int
+}
+
+func registerNightFlags(fs *flag.FlagSet) *nightFlags {
+	return &nightFlags{
+		date:       fs.String("date", "", "Night to plan as YYYY-MM-DD; the dark time at the config's site replaces -timefile and -timestr"),
+		endDate:    fs.String("enddate", "", "Last night to plan as YYYY-MM-DD when planning several nights from -date"),
+		nights:     fs.Int("nights", 0, "Number of nights to plan from -date, or from tonight without -date, instead of -enddate"),
+		darkness:   fs.String("darkness", string(ephemeris.DarknessAstronomical), "Darkness level for -date: civil, nautical or astronomical"),
+		byNight:    fs.Bool("bynight", false, "List the visible time and peak altitude of every object night by night"),
+		bestNights: fs.Int("bestnights", 0, "List only this many nights per object, highest peak first (implies -bynight)"),
+	}
+}
+
+// timeRanges returns the dark time of the nights given by -date and
+// -enddate, or the time ranges from the time file or string without -date
+func (f *nightFlags) timeRanges(config *visibility.ConfigArray, timeFile, timeStr *string) ([]visibility.TimeRange, error) {
+	if *f.date == "" && *f.nights <= 0 {
+		return parseTime(timeFile, timeStr, config.Location())
+	}
+	darkness, err := ephemeris.ParseDarkness(*f.darkness)
+	if err != nil {
+		return nil, err
+	}
+	from, err := f.firstNight(config)
+	if err != nil {
+		return nil, err
+	}
+	to := from
+	if *f.nights > 0 {
+		to = from.AddDate(0, 0, *f.nights-1)
+	} else if *f.endDate != "" {
+		to, err = time.Parse(time.DateOnly, *f.endDate)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing end date: %w", err)
+		}
+	}
+	timeRanges, err := config.DarkTimeRanges(from, to, darkness)
+	if err != nil {
+		return nil, err
+	}
+	if len(timeRanges) == 0 {
+		return nil, fmt.Errorf("no %s darkness between %s and %s", darkness, from.Format(time.DateOnly), to.Format(time.DateOnly))
+	}
+	for _, tr := range timeRanges {
+		fmt.Printf("Dark time (%s): %s - %s\n", darkness, tr.StartTime.Format(time.DateTime), tr.EndTime.Format(time.DateTime))
+	}
+	return timeRanges, nil
+}
+
+// firstNight returns the date given by -date, or tonight at the config's
+// site
+func (f *nightFlags) firstNight(config *visibility.ConfigArray) (time.Time, error) {
+	if *f.date == "" {
+		now := time.Now()
+		if location := config.Location(); location != nil {
+			now = now.In(location)
+		}
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC), nil
+	}
+	from, err := time.Parse(time.DateOnly, *f.date)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error parsing date: %w", err)
+	}
+	return from, nil
+}
+
+// print prints the visibility night by night with -bynight or -bestnights
+// and as a flat list of windows otherwise
+func (f *nightFlags) print(infos []visibility.VisibilityInfo, timeRanges []visibility.TimeRange) {
+	if !*f.byNight && *f.bestNights <= 0 {
+		fmt.Println(visibility.NewSimpleOutputResult().Get(&infos))
+		return
+	}
+	fmt.Println(visibility.NewSimpleOutputResult().GetNightly(visibility.GroupByNight(infos, timeRanges), *f.bestNights))
+}
+
+type moonFlags struct {
+	report     *bool
+	separation *float64
+	width      *float64
+}
+
+func registerMoonFlags(fs *flag.FlagSet) *moonFlags {
+	return &moonFlags{
+		report:     fs.Bool("moon", false, "Report the Moon's illumination, altitude and separation for every window"),
+		separation: fs.Float64("moonseparation", 0, "Separation from the full Moon in degrees required by the Lorentzian moon avoidance (0 disables it)"),
+		width:      fs.Float64("moonwidth", 7, "Width of the Lorentzian moon avoidance in days"),
+	}
+}
+
+func (f *moonFlags) avoidance() *visibility.MoonAvoidance {
+	if *f.separation <= 0 {
+		return nil
+	}
+	return &visibility.MoonAvoidance{Separation: *f.separation, Width: *f.width}
+}
+
+// analyze reports the Moon when asked for or when the avoidance is enabled
+func (f *moonFlags) analyze(infos []visibility.VisibilityInfo, config *visibility.ConfigArray) {
+	avoidance := f.avoidance()
+	if (!*f.report && avoidance == nil) || len(config.Configs) == 0 {
+		return
+	}
+	visibility.AnalyzeMoon(infos, config, avoidance)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/tps193/balcony-stargazer/internal/database"
+	"github.com/tps193/balcony-stargazer/internal/spatial"
+)
+
+func runNear(s []string) {
+	nearCmd := flag.NewFlagSet("near", flag.ExitOnError)
+	object := nearCmd.String("object", "", "Center object by catalog name, Messier number or common name (e.g., M42)")
+	raStr := nearCmd.String("ra", "", "Right ascension of the center as HH:MM:SS or decimal degrees")
+	decStr := nearCmd.String("dec", "", "Declination of the center as [+/-]DD:MM:SS or decimal degrees")
+	radius := nearCmd.Float64("radius", 1.0, "Search radius in degrees")
+	polygon := nearCmd.String("polygon", "", "Polygon vertices as 'ra,dec;ra,dec;...' searched instead of a cone")
+	observationType := nearCmd.String("observationtype", "", "Type of objects to list (e.g., G, HII, OCl)")
+	catalog := nearCmd.String("catalog", database.DefaultCatalog, "Comma separated paths to the catalog CSV files")
+
+	logfile := nearCmd.String("logfile", "", "Path to the log file")
+	logLevel := nearCmd.String("loglevel", "info", "Log level: debug, info, warn or error")
+
+	nearCmd.Parse(s)
+
+	f := initLogging(logfile, logLevel)
+	if f != nil {
+		defer f.Close()
+	}
+
+	rows, err := database.ParseCatalogFiles(database.Filter{}, database.CatalogPaths(*catalog)...)
+	if err != nil {
+		fmt.Println("Error parsing catalog CSV:", err)
+		return
+	}
+	index, err := database.NewCatalogIndex(rows)
+	if err != nil {
+		fmt.Println("Error indexing catalog:", err)
+		return
+	}
+
+	var neighbors []database.Neighbor
+	if *polygon != "" {
+		vertices, err := spatial.ParsePolygon(*polygon)
+		if err != nil {
+			fmt.Println("Error parsing polygon:", err)
+			return
+		}
+		var center spatial.Point
+		neighbors, center, err = index.Polygon(vertices)
+		if err != nil {
+			fmt.Println("Error searching polygon:", err)
+			return
+		}
+		fmt.Printf("Objects inside polygon (centroid RA %.4f°, Dec %.4f°):\n", center.RA, center.Dec)
+	} else {
+		center, name, err := database.ResolveCenter(rows, *object, *raStr, *decStr)
+		if err != nil {
+			fmt.Println("Error resolving center:", err)
+			return
+		}
+		neighbors = index.Cone(center, *radius)
+		fmt.Printf("Objects within %.2f° of %s:\n", *radius, name)
+	}
+
+	for _, n := range neighbors {
+		if *observationType != "" && n.Row.Type != *observationType {
+			continue
+		}
+		fmt.Printf("%s (%s): separation %.3f°, position angle %.1f°\n", n.Row.DisplayName(), n.Row.Type, n.Separation, n.PositionAngle)
+	}
+}
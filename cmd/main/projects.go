@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/tps193/balcony-stargazer/internal/ephemeris"
+	"github.com/tps193/balcony-stargazer/internal/visibility"
+)
+
+func runProjects(s []string) {
+	projectsCmd := flag.NewFlagSet("projects", flag.ExitOnError)
+	configFile := projectsCmd.String("configfile", "", "Path to the configuration file")
+	configStr := projectsCmd.String("configstr", "", "String with configurations in JSON format")
+
+	projectFile := projectsCmd.String("projectfile", "", "Path to the project file")
+	projectStr := projectsCmd.String("projectstr", "", "String with projects in JSON format")
+
+	date := projectsCmd.String("date", "", "First night to plan as YYYY-MM-DD (default: tonight)")
+	nights := projectsCmd.Int("nights", 90, "Number of nights to plan")
+	darkness := projectsCmd.String("darkness", string(ephemeris.DarknessAstronomical), "Darkness level: civil, nautical or astronomical")
+	minBlock := projectsCmd.Int("minblock", 30, "Shortest imaging block in minutes")
+	overhead := projectsCmd.Int("overhead", 5, "Slew and framing time in minutes before every block")
+	maxAirmass := projectsCmd.Float64("maxairmass", 0, "Maximum airmass, e.g. 2 for 30° altitude (0 for no limit)")
+	plan := projectsCmd.Bool("plan", false, "List the planned time of every project per night and filter")
+
+	logfile := projectsCmd.String("logfile", "", "Path to the log file")
+	logLevel := projectsCmd.String("loglevel", "info", "Log level: debug, info, warn or error")
+
+	projectsCmd.Parse(s)
+	if *nights <= 0 {
+		fmt.Println("Error: -nights must be positive")
+		return
+	}
+
+	f := initLogging(logfile, logLevel)
+	if f != nil {
+		defer f.Close()
+	}
+
+	config, err := parseConfig(configFile, configStr)
+	if err != nil {
+		fmt.Println("Error loading configuration:", err)
+		return
+	}
+
+	projectValue, err := readFlag(projectFile, projectStr, "projects")
+	if err != nil {
+		fmt.Println("Error reading projects:", err)
+		return
+	}
+	var projects visibility.ProjectArray
+	if err := json.Unmarshal([]byte(projectValue), &projects); err != nil {
+		fmt.Println("Error parsing json:", err)
+		return
+	}
+	if err := projects.Validate(); err != nil {
+		fmt.Println("Error in projects:", err)
+		return
+	}
+
+	level, err := ephemeris.ParseDarkness(*darkness)
+	if err != nil {
+		fmt.Println("Error parsing darkness:", err)
+		return
+	}
+	night := &nightFlags{date: date}
+	from, err := night.firstNight(config)
+	if err != nil {
+		fmt.Println("Error parsing time range:", err)
+		return
+	}
+	timeRanges, err := config.DarkTimeRanges(from, from.AddDate(0, 0, *nights-1), level)
+	if err != nil {
+		fmt.Println("Error parsing time range:", err)
+		return
+	}
+
+	options := visibility.ScheduleOptions{
+		MinBlock: time.Duration(*minBlock) * time.Minute,
+		Overhead: time.Duration(*overhead) * time.Minute,
+	}
+	if err := options.Validate(); err != nil {
+		fmt.Println("Error in schedule options:", err)
+		return
+	}
+	forecasts := visibility.ForecastProjects(projects.Projects, config, timeRanges, visibility.Filter{MaxVignettingPercent: visibility.DefaultMaxVignettingPercent, MaxAirmass: *maxAirmass}, options)
+	fmt.Printf("Planning %d nights from %s\n", len(timeRanges), from.Format(time.DateOnly))
+	fmt.Println(visibility.NewSimpleOutputResult().GetForecasts(forecasts, *plan))
+}
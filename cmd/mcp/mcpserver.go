@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"os"
@@ -12,6 +13,10 @@ import (
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 
+	"github.com/tps193/balcony-stargazer/internal/database"
+	"github.com/tps193/balcony-stargazer/internal/ephemeris"
+	"github.com/tps193/balcony-stargazer/internal/logging"
+	"github.com/tps193/balcony-stargazer/internal/spatial"
 	"github.com/tps193/balcony-stargazer/internal/visibility"
 )
 
@@ -20,16 +25,40 @@ const (
 	Config       = "config"
 )
 
+var logger = logging.New("mcp")
+
+// The catalog is parsed and indexed once at startup for catalog_near.
+// catalogErr is returned by the tool when that failed.
+var (
+	catalogRows  []database.CatalogRow
+	catalogIndex *database.CatalogIndex
+	catalogErr   error
+)
+
 func main() {
+	logLevel := flag.String("loglevel", "info", "Log level: debug, info, warn or error")
+	catalog := flag.String("catalog", database.DefaultCatalog, "Comma separated paths to the catalog CSV files")
+	flag.Parse()
+
 	f, err := os.OpenFile("mcp.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	// Set log output to the file
-	log.SetOutput(f)
+	logging.SetOutput(f)
+	level, err := logging.ParseLevel(*logLevel)
+	if err != nil {
+		log.Fatal(err)
+	}
+	logging.SetLevel(level)
+
+	logger.Info("log initialized")
 
-	log.Println("Log initialized")
+	catalogRows, catalogIndex, catalogErr = loadCatalog(database.CatalogPaths(*catalog))
+	if catalogErr != nil {
+		logger.Error("error loading catalog", "err", catalogErr)
+	}
 
 	defer f.Close()
 
@@ -68,11 +97,36 @@ func main() {
 		),
 		mcp.WithString("startTime",
 			mcp.Required(),
-			mcp.Description("Must be asked from user and not generated. Observation start time in RFC3339 format (e.g., 2024-06-30T22:30:00-05:00). Timezone is required and must be calculated from the user location from config parameter."),
+			mcp.Description("Must be asked from user and not generated. Observation start time in RFC3339 format (e.g., 2024-06-30T22:30:00-05:00). When the config references a site with a timezone, the offset can be left out (e.g., 2024-06-30T22:30:00) and the time is taken in the site's timezone; otherwise the offset is required."),
 		),
 		mcp.WithString("endTime",
 			mcp.Required(),
-			mcp.Description("Must be asked from user and not generated. Observation end time in RFC3339 format (e.g., 2025-07-01T05:30:00-05:00). Timezone is required and must be calculated from the user location from config parameter."),
+			mcp.Description("Must be asked from user and not generated. Observation end time in RFC3339 format (e.g., 2025-07-01T05:30:00-05:00). When the config references a site with a timezone, the offset can be left out (e.g., 2025-07-01T05:30:00) and the time is taken in the site's timezone; otherwise the offset is required."),
+		),
+		mcp.WithNumber("maxVignettingPercent",
+			mcp.Description("Optional maximum part of the aperture covered by the fence or window edges in percent when the config has a telescope section. 0 rejects any vignetting, 100 accepts any. Defaults to 50."),
+		),
+		mcp.WithNumber("minClearPercent",
+			mcp.Description("Optional minimum unobstructed part of an extended object in percent, using majorAxis, minorAxis and positionAngle of the objects. 0 checks only the center."),
+		),
+		mcp.WithNumber("maxAirmass",
+			mcp.Description("Optional maximum airmass (Kasten-Young), e.g. 2 for about 30° altitude. Time steps through more atmosphere are not counted as visible. 0 disables the limit."),
+		),
+		mcp.WithString("band",
+			mcp.Description("Optional photometric band (U, B, V, R or I) to report the atmospheric extinction of every window in, at its peak and at its lowest point."),
+		),
+		mcp.WithNumber("moonSeparation",
+			mcp.Description("Optional separation from the full Moon in degrees required by a Lorentzian moon avoidance rule; the required separation falls off towards new moon. 0 disables the rule."),
+		),
+		mcp.WithNumber("moonWidth",
+			mcp.Description("Width of the Lorentzian moon avoidance in days."),
+			mcp.DefaultNumber(7),
+		),
+		mcp.WithBoolean("sky",
+			mcp.Description("Include the estimated sky background curve (mag/arcsec² and naked-eye limiting magnitude every 5 minutes) for every window, based on the site's Bortle class or SQM, the Moon, twilight and the object's altitude."),
+		),
+		mcp.WithString("equipment",
+			mcp.Description("Optional equipment profile: vespera-ii, seestar-s50, dwarf-3 or a profile declared in the config. When given, objects with majorAxis set report how they fill the frame and whether they need a mosaic."),
 		),
 	)
 
@@ -88,9 +142,172 @@ func main() {
 		),
 	)
 
+	catalogNearTool := mcp.NewTool("catalog_near",
+		mcp.WithDescription("Searches the catalog for objects near a center object or coordinates (cone search), or inside a polygon of RA/Dec vertices. Returns each object's separation and position angle from the center in degrees. Use it for questions like 'what else is within 2° of M42?'."),
+		mcp.WithString("object",
+			mcp.Description("Center object by catalog name, Messier number or common name (e.g., M42, NGC1976, Orion Nebula). Leave empty when ra and dec or polygon are given."),
+		),
+		mcp.WithString("ra",
+			mcp.Description("Right ascension of the center as HH:MM:SS or decimal degrees."),
+		),
+		mcp.WithString("dec",
+			mcp.Description("Declination of the center as [+/-]DD:MM:SS or decimal degrees."),
+		),
+		mcp.WithNumber("radius",
+			mcp.Description("Search radius in degrees."),
+			mcp.DefaultNumber(1.0),
+		),
+		mcp.WithString("polygon",
+			mcp.Description("Polygon vertices as 'ra,dec;ra,dec;...'. When given, the polygon is searched instead of a cone."),
+		),
+		mcp.WithString("objectType",
+			mcp.Description("Only list objects of this type (e.g., G, HII, OCl, PN)."),
+		),
+	)
+
+	darkTimeTool := mcp.NewTool("dark_time",
+		mcp.WithDescription("Calculates dusk and dawn for the nights starting on the given dates at the site of the config. The returned time ranges can be used as startTime and endTime of astro_object_visibility instead of asking the user for them."),
+		mcp.WithString(Config,
+			mcp.Required(),
+			mcp.Description("Must be asked from user. Configuration formatted as single string json "+configSchema+". It must declare a site with a timezone used by at least one config; dark time is planned at the first config that uses a site."),
+		),
+		mcp.WithString("date",
+			mcp.Required(),
+			mcp.Description("First night as YYYY-MM-DD in the site's timezone."),
+		),
+		mcp.WithString("endDate",
+			mcp.Description("Last night as YYYY-MM-DD. Defaults to date."),
+		),
+		mcp.WithString("darkness",
+			mcp.Description("Darkness level: civil, nautical or astronomical."),
+			mcp.DefaultString("astronomical"),
+		),
+	)
+
+	nightlyVisibilityTool := mcp.NewTool("nightly_visibility",
+		mcp.WithDescription("Calculates the visibility of astronomical objects during the dark time of every night in a date range at the site of the config, e.g. every night for the next 60 days. Returns the windows, visible time and peak altitude per night and the total per object. Use it to pick the nights where an object is highest. Ask user for parameters and wait input before running the tool."),
+		mcp.WithString(AstroObjects,
+			mcp.Required(),
+			mcp.Description("Name and coordinates of the array of astronomical object formatted as single string json "+astroObjectSchema),
+		),
+		mcp.WithString(Config,
+			mcp.Required(),
+			mcp.Description("Must be asked from user. Configuration formatted as single string json "+configSchema+". It must declare a site with a timezone used by at least one config; dark time is planned at the first config that uses a site."),
+		),
+		mcp.WithString("date",
+			mcp.Required(),
+			mcp.Description("First night as YYYY-MM-DD in the site's timezone."),
+		),
+		mcp.WithString("endDate",
+			mcp.Description("Last night as YYYY-MM-DD. Defaults to date."),
+		),
+		mcp.WithNumber("nights",
+			mcp.Description("Number of nights from date, used instead of endDate."),
+		),
+		mcp.WithString("darkness",
+			mcp.Description("Darkness level: civil, nautical or astronomical."),
+			mcp.DefaultString("astronomical"),
+		),
+		mcp.WithNumber("maxAirmass",
+			mcp.Description("Optional maximum airmass (Kasten-Young). 0 disables the limit."),
+		),
+	)
+
+	yearlyCalendarTool := mcp.NewTool("yearly_calendar",
+		mcp.WithDescription("Calculates for every night of a year how many minutes of dark time each astronomical object is visible at the site of the config, and the best imaging season: the longest run of nights with at least half the visible time of the best night. Use it to tell in which months a target can be reached through the balcony. Ask user for parameters and wait input before running the tool."),
+		mcp.WithString(AstroObjects,
+			mcp.Required(),
+			mcp.Description("Name and coordinates of the array of astronomical object formatted as single string json "+astroObjectSchema),
+		),
+		mcp.WithString(Config,
+			mcp.Required(),
+			mcp.Description("Must be asked from user. Configuration formatted as single string json "+configSchema+". It must declare a site with a timezone used by at least one config; dark time is planned at the first config that uses a site."),
+		),
+		mcp.WithNumber("year",
+			mcp.Required(),
+			mcp.Description("Year to plan, e.g. 2026."),
+		),
+		mcp.WithString("darkness",
+			mcp.Description("Darkness level: civil, nautical or astronomical."),
+			mcp.DefaultString("astronomical"),
+		),
+	)
+
+	nightScheduleTool := mcp.NewTool("night_schedule",
+		mcp.WithDescription("Sequences astronomical objects into an imaging timeline for every night in a date range at the site of the config. Whenever the telescope is free the highest priority object that can be imaged for at least minBlock minutes is taken, handing over as one object leaves the balcony opening and another enters. Priorities come from the config's priorities. Returns the blocks, the unused gaps and the imaging, overhead and unused time per night. Ask user for parameters and wait input before running the tool."),
+		mcp.WithString(AstroObjects,
+			mcp.Required(),
+			mcp.Description("Name and coordinates of the array of astronomical object formatted as single string json "+astroObjectSchema),
+		),
+		mcp.WithString(Config,
+			mcp.Required(),
+			mcp.Description("Must be asked from user. Configuration formatted as single string json "+configSchema+". It must declare a site with a timezone used by at least one config; dark time is planned at the first config that uses a site."),
+		),
+		mcp.WithString("date",
+			mcp.Required(),
+			mcp.Description("First night as YYYY-MM-DD in the site's timezone."),
+		),
+		mcp.WithString("endDate",
+			mcp.Description("Last night as YYYY-MM-DD. Defaults to date."),
+		),
+		mcp.WithNumber("nights",
+			mcp.Description("Number of nights from date, used instead of endDate."),
+		),
+		mcp.WithString("darkness",
+			mcp.Description("Darkness level: civil, nautical or astronomical."),
+			mcp.DefaultString("astronomical"),
+		),
+		mcp.WithNumber("minBlock",
+			mcp.Description("Shortest imaging block in minutes."),
+			mcp.DefaultNumber(30),
+		),
+		mcp.WithNumber("overhead",
+			mcp.Description("Slew and framing time in minutes before every block."),
+			mcp.DefaultNumber(5),
+		),
+	)
+
+	projectForecastTool := mcp.NewTool("project_forecast",
+		mcp.WithDescription("Forecasts multi-night imaging projects: allocates the visibility windows of the coming nights at the site of the config to projects with an integration goal until the goals are met, and returns the planned time per night and filter and the forecast completion time of every project. Ask user for parameters and wait input before running the tool."),
+		mcp.WithString("projects",
+			mcp.Required(),
+			mcp.Description(`Projects formatted as single string json {"projects": [{"name": "Veil", "target": <astro object>, "goal": <hours>, "collected": <hours>, "filters": [{"name": "Ha", "goal": <hours>, "collected": <hours>}], "priority": <0-10>}]}. Use either goal and collected or filters. The target is formatted like `+astroObjectSchema),
+		),
+		mcp.WithString(Config,
+			mcp.Required(),
+			mcp.Description("Must be asked from user. Configuration formatted as single string json "+configSchema+". It must declare a site with a timezone used by at least one config; dark time is planned at the first config that uses a site."),
+		),
+		mcp.WithString("date",
+			mcp.Required(),
+			mcp.Description("First night as YYYY-MM-DD in the site's timezone."),
+		),
+		mcp.WithNumber("nights",
+			mcp.Required(),
+			mcp.Description("Number of nights to plan, e.g. 90."),
+		),
+		mcp.WithString("darkness",
+			mcp.Description("Darkness level: civil, nautical or astronomical."),
+			mcp.DefaultString("astronomical"),
+		),
+		mcp.WithNumber("minBlock",
+			mcp.Description("Shortest imaging block in minutes."),
+			mcp.DefaultNumber(30),
+		),
+		mcp.WithNumber("overhead",
+			mcp.Description("Slew and framing time in minutes before every block."),
+			mcp.DefaultNumber(5),
+		),
+	)
+
 	// Add tool handler
 	s.AddTool(visibilityInWindowTool, visibilityHandler)
 	s.AddTool(quickVisibilityFilterTool, quickVisibilityFilterHandler)
+	s.AddTool(catalogNearTool, catalogNearHandler)
+	s.AddTool(darkTimeTool, darkTimeHandler)
+	s.AddTool(nightlyVisibilityTool, nightlyVisibilityHandler)
+	s.AddTool(yearlyCalendarTool, yearlyCalendarHandler)
+	s.AddTool(nightScheduleTool, nightScheduleHandler)
+	s.AddTool(projectForecastTool, projectForecastHandler)
 
 	// Start the stdio server
 	if err := server.ServeStdio(s); err != nil {
@@ -99,59 +316,62 @@ func main() {
 }
 
 func visibilityHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	jsonStr, err := request.RequireString(AstroObjects)
-	if err != nil {
-		log.Println("Error requiring astroObjectInfo: ", err)
-		return mcp.NewToolResultError("Error: error getting required parameter " + AstroObjects + " due to " + err.Error() + ". Single line json string is expected"), nil
-	}
-	log.Println("AstroObjectInfo: ", jsonStr)
-
-	astroObjectArray := &visibility.AstroObjectArray{}
-	err = json.Unmarshal([]byte(jsonStr), astroObjectArray)
-	if err != nil {
-		log.Println(err.Error())
-		return mcp.NewToolResultError("Error unmarshalling Astro Object json: " + err.Error()), nil
-	}
-	log.Println("Unmarshalled object: ", astroObjectArray)
-
-	jsonStr, err = request.RequireString(Config)
+	astroObjectArray, err := parseObjects(request)
 	if err != nil {
-		log.Println("Error requiring config:", err)
-		return mcp.NewToolResultError(err.Error() + ". Single line string json is expected"), nil
+		return mcp.NewToolResultError(err.Error()), nil
 	}
-	log.Println("Config: ", jsonStr)
-
-	config := &visibility.ConfigArray{}
-	err = json.Unmarshal([]byte(jsonStr), config)
+	config, err := parseConfig(request)
 	if err != nil {
-		log.Println(err.Error())
 		return mcp.NewToolResultError(err.Error()), nil
 	}
-	log.Println("Unmarshalled config: ", config)
 
 	startTimeStr, err := request.RequireString("startTime")
 	if err != nil {
-		log.Println("Error requiring startTime:", err)
+		logger.Error("error requiring parameter", "param", "startTime", "err", err)
 		return mcp.NewToolResultError(err.Error() + ". Start time in RFC3339 format (e.g., 2024-06-30T22:30:00Z) is expected"), nil
 	}
-	startTime, err := time.Parse(time.RFC3339, startTimeStr)
+	startTime, err := visibility.ParseTime(startTimeStr, config.Location())
 	if err != nil {
-		log.Println("Error parsing start time:", err)
+		logger.Error("error parsing start time", "err", err)
 		return mcp.NewToolResultError(err.Error()), nil
 	}
 	endTimeStr, err := request.RequireString("endTime")
 	if err != nil {
-		log.Println("Error requiring endTime:", err)
+		logger.Error("error requiring parameter", "param", "endTime", "err", err)
 		return mcp.NewToolResultError(err.Error() + ". End time in RFC3339 format (e.g., 2025-07-01T05:30:00Z) is expected"), nil
 	}
-	endTime, err := time.Parse(time.RFC3339, endTimeStr)
+	endTime, err := visibility.ParseTime(endTimeStr, config.Location())
 	if err != nil {
-		log.Println("Error parsing end time:", err)
+		logger.Error("error parsing end time", "err", err)
 		return mcp.NewToolResultError(err.Error()), nil
 	}
-	log.Printf("Observed time from %s to %s\n", startTime, endTime)
+	logger.Info("observation time", "start", startTime, "end", endTime)
 
-	visibilityInfos := visibility.CalculateAltitudeVisibility(astroObjectArray, config, []visibility.TimeRange{{StartTime: startTime, EndTime: endTime}}, 5, visibility.Filter{}, true)
+	filter := visibility.Filter{MaxVignettingPercent: request.GetFloat("maxVignettingPercent", visibility.DefaultMaxVignettingPercent), MinClearPercent: request.GetFloat("minClearPercent", 0), MaxAirmass: request.GetFloat("maxAirmass", 0)}
+	if separation := request.GetFloat("moonSeparation", 0); separation > 0 {
+		filter.MoonAvoidance = &visibility.MoonAvoidance{Separation: separation, Width: request.GetFloat("moonWidth", 7)}
+	}
+	visibilityInfos := visibility.CalculateAltitudeVisibility(astroObjectArray, config, []visibility.TimeRange{{StartTime: startTime, EndTime: endTime}}, 5, filter, true)
+	if len(config.Configs) > 0 {
+		visibility.AnalyzeMoon(visibilityInfos, config, filter.MoonAvoidance)
+		if request.GetBool("sky", false) {
+			visibility.AnalyzeSkyBrightness(visibilityInfos, config)
+		}
+	}
+	if band := request.GetString("band", ""); band != "" {
+		if err := visibility.AnalyzeExtinction(visibilityInfos, band); err != nil {
+			logger.Error("error computing extinction", "err", err)
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+	}
+	if name := request.GetString("equipment", ""); name != "" {
+		equipment, err := config.FindEquipment(name)
+		if err != nil {
+			logger.Error("error finding equipment", "err", err)
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		visibility.AnalyzeFraming(visibilityInfos, visibility.FramingOptions{Equipment: equipment})
+	}
 	result := visibility.NewJsonOutput().Get(visibilityInfos)
 	return mcp.NewToolResultText(result), nil
 }
@@ -159,37 +379,342 @@ func visibilityHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.C
 func quickVisibilityFilterHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	jsonStr, err := request.RequireString(AstroObjects)
 	if err != nil {
-		log.Println("Error requiring astroObjectInfo: ", err)
+		logger.Error("error requiring parameter", "param", AstroObjects, "err", err)
 		return mcp.NewToolResultError("Error: error getting required parameter " + AstroObjects + " due to " + err.Error() + ". Single line json string is expected"), nil
 	}
-	log.Println("AstroObjectInfo: ", jsonStr)
+	logger.Debug("received parameter", "param", AstroObjects, "value", jsonStr)
 
 	astroObject := visibility.AstroObject{}
 	err = json.Unmarshal([]byte(jsonStr), &astroObject)
 	if err != nil {
-		log.Println(err.Error())
+		logger.Error("error unmarshalling json", "err", err)
 		return mcp.NewToolResultError("Error unmarshalling Astro Object json: " + err.Error()), nil
 	}
-	log.Println("Unmarshalled object: ", astroObject)
+	logger.Debug("unmarshalled object", "object", astroObject)
+
+	config, err := parseConfig(request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if len(config.Configs) == 0 {
+		return mcp.NewToolResultError("Error: the config has no configs"), nil
+	}
+
+	// The object is visible when it is visible with any of the configs
+	neverVisible, everInAzimuthWindow := true, false
+	for i := range config.Configs {
+		neverVisible = neverVisible && visibility.ObjectNeverVisible(astroObject, &config.Configs[i])
+		everInAzimuthWindow = everInAzimuthWindow || visibility.ObjectEverInAzimuthWindow(astroObject, &config.Configs[i])
+	}
+
+	result := fmt.Sprintf("Object %s never visible: %t, ever in azimuth window: %t", astroObject.Name, neverVisible, everInAzimuthWindow)
+	return mcp.NewToolResultText(result), nil
+}
+
+type nearObject struct {
+	Name          string  `json:"name"`
+	Type          string  `json:"type"`
+	RA            string  `json:"ra"`
+	Dec           string  `json:"dec"`
+	Separation    float64 `json:"separation"`
+	PositionAngle float64 `json:"positionAngle"`
+}
+
+type nearResult struct {
+	Center  spatial.Point `json:"center"`
+	Name    string        `json:"name,omitempty"`
+	Objects []nearObject  `json:"objects"`
+}
+
+// loadCatalog parses the catalog files and indexes their objects
+func loadCatalog(paths []string) ([]database.CatalogRow, *database.CatalogIndex, error) {
+	rows, err := database.ParseCatalogFiles(database.Filter{}, paths...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error parsing catalog: %w", err)
+	}
+	index, err := database.NewCatalogIndex(rows)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error indexing catalog: %w", err)
+	}
+	return rows, index, nil
+}
+
+func catalogNearHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	if catalogErr != nil {
+		return mcp.NewToolResultError(catalogErr.Error()), nil
+	}
+
+	result := nearResult{Objects: []nearObject{}}
+	var neighbors []database.Neighbor
+	var err error
+	if polygon := request.GetString("polygon", ""); polygon != "" {
+		vertices, err := spatial.ParsePolygon(polygon)
+		if err != nil {
+			return mcp.NewToolResultError("Error parsing polygon: " + err.Error()), nil
+		}
+		neighbors, result.Center, err = catalogIndex.Polygon(vertices)
+		if err != nil {
+			return mcp.NewToolResultError("Error searching polygon: " + err.Error()), nil
+		}
+	} else {
+		result.Center, result.Name, err = database.ResolveCenter(catalogRows, request.GetString("object", ""), request.GetString("ra", ""), request.GetString("dec", ""))
+		if err != nil {
+			return mcp.NewToolResultError("Error resolving center: " + err.Error()), nil
+		}
+		neighbors = catalogIndex.Cone(result.Center, request.GetFloat("radius", 1.0))
+	}
+
+	objectType := request.GetString("objectType", "")
+	for _, n := range neighbors {
+		if objectType != "" && n.Row.Type != objectType {
+			continue
+		}
+		result.Objects = append(result.Objects, nearObject{
+			Name:          n.Row.DisplayName(),
+			Type:          n.Row.Type,
+			RA:            n.Row.RA,
+			Dec:           n.Row.Dec,
+			Separation:    n.Separation,
+			PositionAngle: n.PositionAngle,
+		})
+	}
+	res, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError("Error creating json: " + err.Error()), nil
+	}
+	return mcp.NewToolResultText(string(res)), nil
+}
+
+func darkTimeHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	config, err := parseConfig(request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	timeRanges, err := darkTimeRanges(config, request)
+	if err != nil {
+		logger.Error("error calculating dark time", "err", err)
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if timeRanges == nil {
+		timeRanges = []visibility.TimeRange{}
+	}
+	res, err := json.Marshal(timeRanges)
+	if err != nil {
+		return mcp.NewToolResultError("Error creating json: " + err.Error()), nil
+	}
+	return mcp.NewToolResultText(string(res)), nil
+}
 
-	jsonStr, err = request.RequireString(Config)
+// parseObjects reads the astronomical objects parameter
+func parseObjects(request mcp.CallToolRequest) (*visibility.AstroObjectArray, error) {
+	jsonStr, err := request.RequireString(AstroObjects)
 	if err != nil {
-		log.Println("Error requiring config:", err)
+		logger.Error("error requiring parameter", "param", AstroObjects, "err", err)
+		return nil, fmt.Errorf("Error: error getting required parameter %s due to %w. Single line json string is expected", AstroObjects, err)
+	}
+	logger.Debug("received parameter", "param", AstroObjects, "value", jsonStr)
+
+	astroObjectArray := &visibility.AstroObjectArray{}
+	if err := json.Unmarshal([]byte(jsonStr), astroObjectArray); err != nil {
+		logger.Error("error unmarshalling json", "err", err)
+		return nil, fmt.Errorf("Error unmarshalling Astro Object json: %w", err)
+	}
+	logger.Debug("unmarshalled objects", "objects", astroObjectArray)
+	return astroObjectArray, nil
+}
+
+// parseConfig reads the config parameter and resolves its mount profiles
+// and sites
+func parseConfig(request mcp.CallToolRequest) (*visibility.ConfigArray, error) {
+	jsonStr, err := request.RequireString(Config)
+	if err != nil {
+		logger.Error("error requiring parameter", "param", Config, "err", err)
+		return nil, fmt.Errorf("%w. Single line string json is expected", err)
+	}
+	logger.Debug("received parameter", "param", Config, "value", jsonStr)
+
+	config := &visibility.ConfigArray{}
+	if err := json.Unmarshal([]byte(jsonStr), config); err != nil {
+		logger.Error("error unmarshalling json", "err", err)
+		return nil, err
+	}
+	if err := config.ResolveMounts(); err != nil {
+		logger.Error("error resolving mount profiles", "err", err)
+		return nil, err
+	}
+	if err := config.ResolveSites(); err != nil {
+		logger.Error("error resolving sites", "err", err)
+		return nil, err
+	}
+	if config.Scoring != nil {
+		if err := config.Scoring.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	logger.Debug("unmarshalled config", "config", config)
+	return config, nil
+}
+
+// darkTimeRanges returns the dark time of the nights given by the date,
+// endDate or nights and darkness parameters
+func darkTimeRanges(config *visibility.ConfigArray, request mcp.CallToolRequest) ([]visibility.TimeRange, error) {
+	darkness, err := ephemeris.ParseDarkness(request.GetString("darkness", string(ephemeris.DarknessAstronomical)))
+	if err != nil {
+		return nil, err
+	}
+	dateStr, err := request.RequireString("date")
+	if err != nil {
+		return nil, fmt.Errorf("%w. Date as YYYY-MM-DD is expected", err)
+	}
+	from, err := time.Parse(time.DateOnly, dateStr)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing date: %w", err)
+	}
+	to := from
+	if nights := request.GetInt("nights", 0); nights > 0 {
+		to = from.AddDate(0, 0, nights-1)
+	} else if endDateStr := request.GetString("endDate", ""); endDateStr != "" {
+		to, err = time.Parse(time.DateOnly, endDateStr)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing end date: %w", err)
+		}
+	}
+	return config.DarkTimeRanges(from, to, darkness)
+}
+
+func nightlyVisibilityHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	astroObjectArray, err := parseObjects(request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	config, err := parseConfig(request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	timeRanges, err := darkTimeRanges(config, request)
+	if err != nil {
+		logger.Error("error calculating dark time", "err", err)
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	filter := visibility.Filter{MaxVignettingPercent: visibility.DefaultMaxVignettingPercent, MaxAirmass: request.GetFloat("maxAirmass", 0)}
+	visibilityInfos := visibility.CalculateAltitudeVisibility(astroObjectArray, config, timeRanges, 5, filter, false)
+	res, err := json.Marshal(visibility.GroupByNight(visibilityInfos, timeRanges))
+	if err != nil {
+		return mcp.NewToolResultError("Error creating json: " + err.Error()), nil
+	}
+	return mcp.NewToolResultText(string(res)), nil
+}
+
+func yearlyCalendarHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	astroObjectArray, err := parseObjects(request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	config, err := parseConfig(request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	year, err := request.RequireInt("year")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	darkness, err := ephemeris.ParseDarkness(request.GetString("darkness", string(ephemeris.DarknessAstronomical)))
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	calendars, err := visibility.CalculateCalendars(astroObjectArray, config, year, darkness, visibility.Filter{MaxVignettingPercent: visibility.DefaultMaxVignettingPercent})
+	if err != nil {
+		logger.Error("error calculating calendar", "err", err)
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	res, err := json.Marshal(calendars)
+	if err != nil {
+		return mcp.NewToolResultError("Error creating json: " + err.Error()), nil
+	}
+	return mcp.NewToolResultText(string(res)), nil
+}
+
+func nightScheduleHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	astroObjectArray, err := parseObjects(request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	config, err := parseConfig(request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	timeRanges, err := darkTimeRanges(config, request)
+	if err != nil {
+		logger.Error("error calculating dark time", "err", err)
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	visibilityInfos := visibility.CalculateAltitudeVisibility(astroObjectArray, config, timeRanges, 5, visibility.Filter{MaxVignettingPercent: visibility.DefaultMaxVignettingPercent}, true)
+	options := visibility.ScheduleOptions{
+		MinBlock:   time.Duration(request.GetFloat("minBlock", 30) * float64(time.Minute)),
+		Overhead:   time.Duration(request.GetFloat("overhead", 5) * float64(time.Minute)),
+		Priorities: config.Priorities,
+	}
+	if err := options.Validate(); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	res, err := json.Marshal(visibility.ScheduleNights(visibilityInfos, timeRanges, options))
+	if err != nil {
+		return mcp.NewToolResultError("Error creating json: " + err.Error()), nil
+	}
+	return mcp.NewToolResultText(string(res)), nil
+}
+
+func projectForecastHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	jsonStr, err := request.RequireString("projects")
+	if err != nil {
+		logger.Error("error requiring parameter", "param", "projects", "err", err)
 		return mcp.NewToolResultError(err.Error() + ". Single line string json is expected"), nil
 	}
-	log.Println("Config: ", jsonStr)
+	projects := &visibility.ProjectArray{}
+	if err := json.Unmarshal([]byte(jsonStr), projects); err != nil {
+		logger.Error("error unmarshalling json", "err", err)
+		return mcp.NewToolResultError("Error unmarshalling projects json: " + err.Error()), nil
+	}
+	if err := projects.Validate(); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
 
-	config := &visibility.Config{}
-	err = json.Unmarshal([]byte(jsonStr), config)
+	nights, err := request.RequireInt("nights")
 	if err != nil {
-		log.Println(err.Error())
 		return mcp.NewToolResultError(err.Error()), nil
 	}
-	log.Println("Unmarshalled config: ", config)
+	if nights <= 0 {
+		return mcp.NewToolResultError("nights must be positive"), nil
+	}
 
-	neverVisible := visibility.ObjectNeverVisible(astroObject, config)
-	everInAzimuthWindow := visibility.ObjectEverInAzimuthWindow(astroObject, config)
+	config, err := parseConfig(request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
 
-	result := fmt.Sprintf("Object %s never visible: %t, ever in azimuth window: %t", astroObject.Name, neverVisible, everInAzimuthWindow)
-	return mcp.NewToolResultText(result), nil
+	timeRanges, err := darkTimeRanges(config, request)
+	if err != nil {
+		logger.Error("error calculating dark time", "err", err)
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	options := visibility.ScheduleOptions{
+		MinBlock: time.Duration(request.GetFloat("minBlock", 30) * float64(time.Minute)),
+		Overhead: time.Duration(request.GetFloat("overhead", 5) * float64(time.Minute)),
+	}
+	if err := options.Validate(); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	res, err := json.Marshal(visibility.ForecastProjects(projects.Projects, config, timeRanges, visibility.Filter{MaxVignettingPercent: visibility.DefaultMaxVignettingPercent}, options))
+	if err != nil {
+		return mcp.NewToolResultError("Error creating json: " + err.Error()), nil
+	}
+	return mcp.NewToolResultText(string(res)), nil
 }
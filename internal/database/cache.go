@@ -0,0 +1,123 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// cacheVersion identifies the layout of the compiled catalog. It must be
+// bumped whenever CatalogRow or parseCSV change, so stale caches are rebuilt.
+const cacheVersion = 2
+
+// CacheSuffix is appended to a catalog CSV path to get its compiled cache.
+const CacheSuffix = ".cache"
+
+// cacheHeader precedes the rows in the cache file
+type cacheHeader struct {
+	Version  int
+	Checksum [sha256.Size]byte
+}
+
+// LoadCatalog returns every row of the catalog CSV at filePath. It prefers
+// the compiled cache next to the CSV and rebuilds it when the cache is
+// missing, was written by another version or the CSV checksum changed.
+func LoadCatalog(filePath string) ([]CatalogRow, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	checksum := sha256.Sum256(content)
+
+	cachePath := filePath + CacheSuffix
+	rows, err := readCache(cachePath, checksum)
+	if err == nil {
+		logger.Debug("loaded compiled catalog", "file", cachePath, "entries", len(rows))
+		return rows, nil
+	}
+	logger.Debug("compiled catalog unusable, parsing CSV", "file", cachePath, "reason", err)
+
+	rows, err = parseCSV(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	if err := writeCache(cachePath, checksum, rows); err != nil {
+		// The cache is an optimization only, e.g. the directory may be read-only
+		logger.Warn("error writing compiled catalog", "file", cachePath, "err", err)
+	}
+	return rows, nil
+}
+
+// BuildCatalogCache parses the catalog CSV at filePath and writes its compiled
+// cache unconditionally.
+func BuildCatalogCache(filePath string) error {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	rows, err := parseCSV(bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	return writeCache(filePath+CacheSuffix, sha256.Sum256(content), rows)
+}
+
+func readCache(cachePath string, checksum [sha256.Size]byte) ([]CatalogRow, error) {
+	file, err := os.Open(cachePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	decoder := gob.NewDecoder(bufio.NewReader(file))
+	var header cacheHeader
+	if err := decoder.Decode(&header); err != nil {
+		return nil, fmt.Errorf("error reading cache header: %w", err)
+	}
+	if header.Version != cacheVersion {
+		return nil, fmt.Errorf("cache version %d, expected %d", header.Version, cacheVersion)
+	}
+	if header.Checksum != checksum {
+		return nil, errors.New("catalog CSV has changed")
+	}
+	var rows []CatalogRow
+	if err := decoder.Decode(&rows); err != nil {
+		return nil, fmt.Errorf("error reading cache rows: %w", err)
+	}
+	return rows, nil
+}
+
+// writeCache writes the header and rows as two gob values, so the header can
+// be checked without decoding the rows. The file is renamed into place to
+// avoid readers seeing a partial cache.
+func writeCache(cachePath string, checksum [sha256.Size]byte, rows []CatalogRow) error {
+	tmp, err := os.CreateTemp(filepath.Dir(cachePath), ".catalog-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	encoder := gob.NewEncoder(w)
+	if err := encoder.Encode(cacheHeader{Version: cacheVersion, Checksum: checksum}); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := encoder.Encode(rows); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), cachePath)
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadCatalogUsesAndInvalidatesCache(t *testing.T) {
+	content, err := os.ReadFile("../../database/addendum.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	csvPath := filepath.Join(t.TempDir(), "addendum.csv")
+	if err := os.WriteFile(csvPath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := LoadCatalog(csvPath)
+	if err != nil {
+		t.Fatalf("LoadCatalog failed: %v", err)
+	}
+	if _, err := os.Stat(csvPath + CacheSuffix); err != nil {
+		t.Fatalf("expected cache to be written: %v", err)
+	}
+
+	cached, err := readCache(csvPath+CacheSuffix, sha256Of(t, csvPath))
+	if err != nil {
+		t.Fatalf("cache should be valid: %v", err)
+	}
+	if !reflect.DeepEqual(parsed, cached) {
+		t.Errorf("cached rows differ from parsed rows")
+	}
+
+	// Changing the CSV must invalidate the cache
+	extra := "X001;HII;01:00:00.0;+10:00:00;Psc;;;;;;;;;;;;;;;;;;;;;;;;Test Nebula;;;\n"
+	if err := os.WriteFile(csvPath, append(content, extra...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := LoadCatalog(csvPath)
+	if err != nil {
+		t.Fatalf("LoadCatalog failed: %v", err)
+	}
+	if len(rows) != len(parsed)+1 || rows[len(rows)-1].Commonnames != "Test Nebula" {
+		t.Errorf("expected the changed CSV to be re-parsed, got %d rows", len(rows))
+	}
+}
+
+func sha256Of(t *testing.T, path string) [sha256.Size]byte {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sha256.Sum256(content)
+}
@@ -7,3 +7,45 @@ type Filter struct {
 	MaxMagnitude      float64
 	MaxSizeArcMinutes float64
 }
+
+// Matches reports whether the row passes the filter
+func (filter *Filter) Matches(entry *CatalogRow) bool {
+	if filter.ObjectType != nil && *filter.ObjectType != "" && entry.Type != *filter.ObjectType {
+		return false
+	}
+
+	if filter.MinSizeArcMinutes > 0 || filter.MaxSizeArcMinutes > 0 {
+		majAx, err := toFloat(entry.MajAx)
+		if err != nil {
+			return false
+		}
+		minAx, err := toFloat(entry.MinAx)
+		if err != nil {
+			return false
+		}
+		minSize := min(majAx, minAx)
+		maxSize := max(majAx, minAx)
+
+		if filter.MinSizeArcMinutes > 0 && minSize < filter.MinSizeArcMinutes {
+			return false
+		}
+		if filter.MaxSizeArcMinutes > 0 && maxSize > filter.MaxSizeArcMinutes {
+			return false
+		}
+	}
+
+	if filter.MinMagnitude > 0 || filter.MaxMagnitude > 0 {
+		vMag, err := toFloat(entry.VMag)
+		if err != nil {
+			return false
+		}
+
+		if filter.MinMagnitude > 0 && vMag > filter.MinMagnitude {
+			return false
+		}
+		if filter.MaxMagnitude > 0 && vMag < filter.MaxMagnitude {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,163 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/tps193/balcony-stargazer/internal/spatial"
+)
+
+// CatalogIndex answers positional queries over catalog rows.
+type CatalogIndex struct {
+	rows  []CatalogRow
+	index *spatial.Index
+}
+
+// Neighbor is a catalog row found by a positional query, with its separation
+// and position angle from the query center in degrees.
+type Neighbor struct {
+	Row           CatalogRow `json:"row"`
+	Separation    float64    `json:"separation"`
+	PositionAngle float64    `json:"positionAngle"`
+}
+
+// Position returns the row's equatorial position in degrees.
+func (row *CatalogRow) Position() (spatial.Point, error) {
+	ra, err := spatial.ParseRA(row.RA)
+	if err != nil {
+		return spatial.Point{}, err
+	}
+	dec, err := spatial.ParseDec(row.Dec)
+	if err != nil {
+		return spatial.Point{}, err
+	}
+	return spatial.Point{RA: ra, Dec: dec}, nil
+}
+
+// NewCatalogIndex builds a spatial index over rows.
+func NewCatalogIndex(rows []CatalogRow) (*CatalogIndex, error) {
+	points := make([]spatial.Point, len(rows))
+	for i := range rows {
+		p, err := rows[i].Position()
+		if err != nil {
+			return nil, fmt.Errorf("invalid position of %s: %w", rows[i].Name, err)
+		}
+		points[i] = p
+	}
+	return &CatalogIndex{rows: rows, index: spatial.NewIndex(points, spatial.DefaultCellSize)}, nil
+}
+
+// Cone returns the rows within radius degrees of center, closest first.
+func (ci *CatalogIndex) Cone(center spatial.Point, radius float64) []Neighbor {
+	return ci.neighbors(ci.index.Cone(center, radius))
+}
+
+// Polygon returns the rows inside the spherical polygon with the given
+// vertices, measured from the polygon's centroid, which is returned as well.
+func (ci *CatalogIndex) Polygon(vertices []spatial.Point) ([]Neighbor, spatial.Point, error) {
+	matches, center, err := ci.index.Polygon(vertices)
+	if err != nil {
+		return nil, center, err
+	}
+	return ci.neighbors(matches), center, nil
+}
+
+func (ci *CatalogIndex) neighbors(matches []spatial.Match) []Neighbor {
+	result := make([]Neighbor, 0, len(matches))
+	for _, m := range matches {
+		result = append(result, Neighbor{
+			Row:           ci.rows[m.Index],
+			Separation:    m.Separation,
+			PositionAngle: m.PositionAngle,
+		})
+	}
+	return result
+}
+
+// FindObject looks a row up by catalog name ("NGC1976", "NGC 1976"), Messier
+// number ("M42") or common name ("Orion Nebula"), ignoring case.
+func FindObject(rows []CatalogRow, name string) (*CatalogRow, bool) {
+	designation := NormalizeDesignation(name)
+	messier, isMessier := messierNumber(designation)
+	for i := range rows {
+		row := &rows[i]
+		if NormalizeDesignation(row.Name) == designation {
+			return row, true
+		}
+		if isMessier && row.M != "" {
+			if m, err := strconv.ParseFloat(row.M, 64); err == nil && int(m) == messier {
+				return row, true
+			}
+		}
+	}
+	for i := range rows {
+		for _, common := range strings.Split(rows[i].Commonnames, ",") {
+			if common != "" && strings.EqualFold(strings.TrimSpace(common), strings.TrimSpace(name)) {
+				return &rows[i], true
+			}
+		}
+	}
+	return nil, false
+}
+
+// NormalizeDesignation upper-cases s, removes spaces and strips leading zeros
+// from the number, so "ngc 224" and "NGC0224" compare equal.
+func NormalizeDesignation(s string) string {
+	s = strings.ToUpper(strings.ReplaceAll(s, " ", ""))
+	i := strings.IndexFunc(s, unicode.IsDigit)
+	if i < 0 {
+		return s
+	}
+	number := strings.TrimLeft(s[i:], "0")
+	if number == "" || !unicode.IsDigit(rune(number[0])) {
+		number = "0" + number
+	}
+	return s[:i] + number
+}
+
+func messierNumber(designation string) (int, bool) {
+	if !strings.HasPrefix(designation, "M") {
+		return 0, false
+	}
+	n, err := strconv.Atoi(designation[1:])
+	return n, err == nil
+}
+
+// ResolveCenter returns the query center either from a catalog object or from
+// explicit coordinates, together with a name to show for it.
+func ResolveCenter(rows []CatalogRow, object, ra, dec string) (spatial.Point, string, error) {
+	if object != "" {
+		if ra != "" || dec != "" {
+			return spatial.Point{}, "", errors.New("either an object or coordinates can be provided")
+		}
+		row, ok := FindObject(rows, object)
+		if !ok {
+			return spatial.Point{}, "", fmt.Errorf("object %s not found in catalog", object)
+		}
+		center, err := row.Position()
+		return center, row.DisplayName(), err
+	}
+	if ra == "" || dec == "" {
+		return spatial.Point{}, "", errors.New("an object or both ra and dec are required")
+	}
+	raDeg, err := spatial.ParseRA(ra)
+	if err != nil {
+		return spatial.Point{}, "", err
+	}
+	decDeg, err := spatial.ParseDec(dec)
+	if err != nil {
+		return spatial.Point{}, "", err
+	}
+	return spatial.Point{RA: raDeg, Dec: decDeg}, fmt.Sprintf("RA %s, Dec %s", ra, dec), nil
+}
+
+// DisplayName returns the catalog name followed by the common names, if any.
+func (row *CatalogRow) DisplayName() string {
+	if row.Commonnames != "" {
+		return fmt.Sprintf("%s (%s)", row.Name, row.Commonnames)
+	}
+	return row.Name
+}
@@ -0,0 +1,42 @@
+package database
+
+import "testing"
+
+func TestFindObjectAndCone(t *testing.T) {
+	rows, err := ParseCatalogCSV(Filter{}, "../../database/NGC_with_common_names.csv")
+	if err != nil {
+		t.Fatalf("ParseCatalogCSV failed: %v", err)
+	}
+	for name, want := range map[string]string{
+		"M42":          "NGC1976",
+		"m 31":         "NGC0224",
+		"ngc 224":      "NGC0224",
+		"Orion Nebula": "NGC1976",
+	} {
+		row, ok := FindObject(rows, name)
+		if !ok || row.Name != want {
+			t.Errorf("FindObject(%q) = %v, want %s", name, row, want)
+		}
+	}
+
+	index, err := NewCatalogIndex(rows)
+	if err != nil {
+		t.Fatalf("NewCatalogIndex failed: %v", err)
+	}
+	center, _, err := ResolveCenter(rows, "M42", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, n := range index.Cone(center, 1) {
+		if n.Row.Name == "NGC1977" {
+			found = true
+			if n.Separation > 1 {
+				t.Errorf("NGC1977 separation %f is outside of the radius", n.Separation)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("expected NGC1977 within 1° of M42")
+	}
+}
@@ -4,10 +4,14 @@ import (
 	"encoding/csv"
 	"fmt"
 	"io"
-	"log"
-	"os"
+	"strconv"
+	"strings"
+
+	"github.com/tps193/balcony-stargazer/internal/logging"
 )
 
+var logger = logging.New("catalog")
+
 type CatalogRow struct {
 	Name        string
 	Type        string
@@ -19,24 +23,71 @@ type CatalogRow struct {
 	PosAng      string
 	BMag        string
 	VMag        string
+	SurfBr      string
+	M           string
+	Identifiers string
 	Commonnames string
 	// ... add more fields as needed
+	// Bump cacheVersion in cache.go when fields are added
 }
 
 // ParseCatalogCSV parses a catalog CSV file and returns a slice of CatalogRow
+// matching the filter. The compiled catalog cache is used when it is up to date.
 func ParseCatalogCSV(filter Filter, filePath string) ([]CatalogRow, error) {
-	file, err := os.Open(filePath)
+	rows, err := LoadCatalog(filePath)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
 
-	reader := csv.NewReader(file)
+	var entries []CatalogRow
+	for _, row := range rows {
+		if filter.Matches(&row) {
+			entries = append(entries, row)
+		}
+	}
+	logger.Debug("filtered catalog", "file", filePath, "entries", len(entries))
+	return entries, nil
+}
+
+// DefaultCatalog lists the catalog files shipped in the database directory,
+// comma separated as accepted by CatalogPaths
+const DefaultCatalog = "database/NGC_with_common_names.csv,database/addendum.csv"
+
+// CatalogPaths splits a comma separated list of catalog files, dropping
+// spaces around the paths and empty entries
+func CatalogPaths(list string) []string {
+	var paths []string
+	for _, p := range strings.Split(list, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// ParseCatalogFiles parses several catalog CSV files with the same filter and
+// returns their rows in order
+func ParseCatalogFiles(filter Filter, filePaths ...string) ([]CatalogRow, error) {
+	var entries []CatalogRow
+	for _, filePath := range filePaths {
+		fileEntries, err := ParseCatalogCSV(filter, filePath)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing catalog %s: %w", filePath, err)
+		}
+		entries = append(entries, fileEntries...)
+	}
+	return entries, nil
+}
+
+// parseCSV reads every row of a semicolon separated catalog file
+func parseCSV(r io.Reader) ([]CatalogRow, error) {
+	reader := csv.NewReader(r)
 	reader.Comma = ';'
 	reader.FieldsPerRecord = -1 // allow variable number of fields
+	reader.ReuseRecord = true
 
 	// Read header
-	_, err = reader.Read()
+	_, err := reader.Read()
 	if err != nil {
 		return nil, err
 	}
@@ -51,7 +102,7 @@ func ParseCatalogCSV(filter Filter, filePath string) ([]CatalogRow, error) {
 			return nil, err
 		}
 
-		entry := CatalogRow{
+		entries = append(entries, CatalogRow{
 			Name:        getField(record, 0),
 			Type:        getField(record, 1),
 			RA:          getField(record, 2),
@@ -62,62 +113,17 @@ func ParseCatalogCSV(filter Filter, filePath string) ([]CatalogRow, error) {
 			PosAng:      getField(record, 7),
 			BMag:        getField(record, 8),
 			VMag:        getField(record, 9),
+			SurfBr:      getField(record, 13),
+			M:           getField(record, 23),
+			Identifiers: getField(record, 27),
 			Commonnames: getField(record, 28),
-		}
-
-		log.Println("Processing entry:", entry.Name)
-
-		objectType := entry.Type
-		if filter.ObjectType != nil && *filter.ObjectType != "" && objectType != *filter.ObjectType {
-			continue
-		}
-
-		if filter.MinSizeArcMinutes > 0 || filter.MaxSizeArcMinutes > 0 {
-			majAx, err := toFloat(entry.MajAx)
-			if err != nil {
-				continue
-			}
-			minAx, err := toFloat(entry.MinAx)
-			if err != nil {
-				continue
-			}
-			minSize := min(majAx, minAx)
-			maxSize := max(majAx, minAx)
-
-			if filter.MinSizeArcMinutes > 0 && minSize < filter.MinSizeArcMinutes {
-				continue
-			}
-			if filter.MaxSizeArcMinutes > 0 && maxSize > filter.MaxSizeArcMinutes {
-				continue
-			}
-		}
-
-		if filter.MinMagnitude > 0 || filter.MaxMagnitude > 0 {
-			vMag, err := toFloat(entry.VMag)
-			if err != nil {
-				continue
-			}
-
-			if filter.MinMagnitude > 0 && vMag > filter.MinMagnitude {
-				continue
-			}
-			if filter.MaxMagnitude > 0 && vMag < filter.MaxMagnitude {
-				continue
-			}
-		}
-
-		entries = append(entries, entry)
+		})
 	}
 	return entries, nil
 }
 
 func toFloat(s string) (float64, error) {
-	var f float64
-	_, err := fmt.Sscanf(s, "%f", &f)
-	if err != nil {
-		return 0.0, err
-	}
-	return f, nil
+	return strconv.ParseFloat(strings.TrimSpace(s), 64)
 }
 
 // getField safely gets a field from a record or returns an empty string if out of range
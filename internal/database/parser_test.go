@@ -82,3 +82,10 @@ func TestParseCatalogCSV_Filters(t *testing.T) {
 }
 
 func strPtr(s string) *string { return &s }
+
+func TestCatalogPaths(t *testing.T) {
+	paths := CatalogPaths(" a.csv, b.csv,,")
+	if len(paths) != 2 || paths[0] != "a.csv" || paths[1] != "b.csv" {
+		t.Errorf("CatalogPaths = %q, want [a.csv b.csv]", paths)
+	}
+}
@@ -0,0 +1,66 @@
+// Package ephemeris computes low-precision positions of the Sun and the Moon,
+// accurate to about a hundredth of a degree for the Sun and a few tenths for
+// the Moon, which is plenty for planning observations.
+package ephemeris
+
+import (
+	"math"
+	"time"
+
+	"github.com/tps193/balcony-stargazer/internal/spatial"
+)
+
+const j2000 = 2451545.0
+
+func deg2rad(deg float64) float64 {
+	return deg * math.Pi / 180.0
+}
+
+func rad2deg(rad float64) float64 {
+	return rad * 180.0 / math.Pi
+}
+
+func normalize360(deg float64) float64 {
+	deg = math.Mod(deg, 360)
+	if deg < 0 {
+		deg += 360
+	}
+	return deg
+}
+
+// julianDate returns the Julian date of t
+func julianDate(t time.Time) float64 {
+	return 2440587.5 + float64(t.UTC().UnixNano())/86400e9
+}
+
+// siderealTime returns the local mean sidereal time in degrees
+func siderealTime(t time.Time, longitude float64) float64 {
+	jd := julianDate(t)
+	T := (jd - j2000) / 36525.0
+	gst := 280.46061837 + 360.98564736629*(jd-j2000) + 0.000387933*T*T - T*T*T/38710000.0
+	return normalize360(gst + longitude)
+}
+
+// Horizontal converts an equatorial position to altitude and azimuth in
+// degrees, azimuth measured from north through east
+func Horizontal(p spatial.Point, latitude, longitude float64, t time.Time) (altitude, azimuth float64) {
+	ha := deg2rad(siderealTime(t, longitude) - p.RA)
+	dec, lat := deg2rad(p.Dec), deg2rad(latitude)
+	alt := math.Asin(math.Sin(lat)*math.Sin(dec) + math.Cos(lat)*math.Cos(dec)*math.Cos(ha))
+	az := math.Atan2(math.Sin(ha), math.Cos(ha)*math.Sin(lat)-math.Tan(dec)*math.Cos(lat))
+	return rad2deg(alt), normalize360(rad2deg(az) + 180)
+}
+
+// equatorial converts ecliptic longitude and latitude in degrees to an
+// equatorial position
+func equatorial(lambda, beta, obliquity float64) spatial.Point {
+	l, b, e := deg2rad(lambda), deg2rad(beta), deg2rad(obliquity)
+	ra := math.Atan2(math.Sin(l)*math.Cos(e)-math.Tan(b)*math.Sin(e), math.Cos(l))
+	dec := math.Asin(math.Sin(b)*math.Cos(e) + math.Cos(b)*math.Sin(e)*math.Sin(l))
+	return spatial.Point{RA: normalize360(rad2deg(ra)), Dec: rad2deg(dec)}
+}
+
+// obliquity returns the obliquity of the ecliptic in degrees, n days after J2000
+func obliquity(n float64) float64 {
+	return 23.439 - 0.0000004*n
+}
@@ -0,0 +1,63 @@
+package ephemeris
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/tps193/balcony-stargazer/internal/spatial"
+)
+
+func TestSunAtSolstice(t *testing.T) {
+	sun := Sun(time.Date(2025, 6, 21, 2, 42, 0, 0, time.UTC))
+	if math.Abs(sun.Dec-23.44) > 0.02 {
+		t.Errorf("declination = %f, want 23.44", sun.Dec)
+	}
+	if math.Abs(sun.RA-90) > 0.1 {
+		t.Errorf("RA = %f, want 90", sun.RA)
+	}
+}
+
+func TestDarkNight(t *testing.T) {
+	location, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	date := time.Date(2025, 7, 30, 0, 0, 0, 0, time.UTC)
+	civil := DarkNight(37.38, -121.89, date, location, DarknessCivil)
+	astronomical := DarkNight(37.38, -121.89, date, location, DarknessAstronomical)
+	if !civil.Dusk.Before(astronomical.Dusk) || !astronomical.Dawn.Before(civil.Dawn) {
+		t.Errorf("astronomical night %v - %v should be inside civil night %v - %v", astronomical.Dusk, astronomical.Dawn, civil.Dusk, civil.Dawn)
+	}
+	for _, when := range []time.Time{astronomical.Dusk, astronomical.Dawn} {
+		if alt := SunAltitude(37.38, -121.89, when); math.Abs(alt+18) > 0.05 {
+			t.Errorf("Sun altitude at %v = %f, want -18", when, alt)
+		}
+	}
+	// Astronomical dusk in San Jose at the end of July is just before 22:00 PDT
+	if dusk := astronomical.Dusk.In(location); dusk.Hour() != 21 || dusk.Minute() < 50 {
+		t.Errorf("dusk = %v, want about 21:58", dusk)
+	}
+
+	// No astronomical darkness in the northern summer above the Arctic Circle
+	polar := DarkNight(70, 20, time.Date(2025, 6, 21, 0, 0, 0, 0, time.UTC), time.UTC, DarknessAstronomical)
+	if polar.IsDark() {
+		t.Errorf("expected no dark time, got %v - %v", polar.Dusk, polar.Dawn)
+	}
+}
+
+func TestMoonPhase(t *testing.T) {
+	// Full moon on 2025-09-07 18:09 UTC, new moon on 2025-09-21 19:54 UTC
+	full, age := MoonPhase(time.Date(2025, 9, 7, 18, 9, 0, 0, time.UTC))
+	if full < 0.99 || math.Abs(age-SynodicMonth/2) > 0.5 {
+		t.Errorf("full moon illumination %f, age %f", full, age)
+	}
+	if newMoon, _ := MoonPhase(time.Date(2025, 9, 21, 19, 54, 0, 0, time.UTC)); newMoon > 0.01 {
+		t.Errorf("new moon illumination %f", newMoon)
+	}
+	// Opposite the Sun at full moon
+	when := time.Date(2025, 9, 7, 18, 9, 0, 0, time.UTC)
+	if sep := spatial.Separation(Moon(when), Sun(when)); sep < 178 {
+		t.Errorf("Moon-Sun separation at full moon = %f", sep)
+	}
+}
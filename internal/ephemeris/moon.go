@@ -0,0 +1,54 @@
+package ephemeris
+
+import (
+	"math"
+	"time"
+
+	"github.com/tps193/balcony-stargazer/internal/spatial"
+)
+
+// SynodicMonth is the mean length of a lunation in days
+const SynodicMonth = 29.530589
+
+// moonEcliptic returns the Moon's geocentric ecliptic longitude, latitude
+// and horizontal parallax in degrees, and the days since J2000
+func moonEcliptic(t time.Time) (lambda, beta, parallax, n float64) {
+	n = julianDate(t) - j2000
+	T := n / 36525.0
+	sin := func(deg float64) float64 { return math.Sin(deg2rad(deg)) }
+	cos := func(deg float64) float64 { return math.Cos(deg2rad(deg)) }
+	lambda = 218.32 + 481267.881*T +
+		6.29*sin(134.9+477198.85*T) - 1.27*sin(259.2-413335.38*T) +
+		0.66*sin(235.7+890534.23*T) + 0.21*sin(269.9+954397.70*T) -
+		0.19*sin(357.5+35999.05*T) - 0.11*sin(186.6+966404.05*T)
+	beta = 5.13*sin(93.3+483202.03*T) + 0.28*sin(228.2+960400.87*T) -
+		0.28*sin(318.3+6003.18*T) - 0.17*sin(217.6-407332.20*T)
+	parallax = 0.9508 + 0.0518*cos(134.9+477198.85*T) + 0.0095*cos(259.2-413335.38*T) +
+		0.0078*cos(235.7+890534.23*T) + 0.0028*cos(269.9+954397.70*T)
+	return normalize360(lambda), beta, parallax, n
+}
+
+// Moon returns the geocentric equatorial position of the Moon
+func Moon(t time.Time) spatial.Point {
+	lambda, beta, _, n := moonEcliptic(t)
+	return equatorial(lambda, beta, obliquity(n))
+}
+
+// MoonHorizontal returns the Moon's altitude and azimuth in degrees as seen
+// from the location, corrected for the parallax of up to a degree
+func MoonHorizontal(latitude, longitude float64, t time.Time) (altitude, azimuth float64) {
+	lambda, beta, parallax, n := moonEcliptic(t)
+	altitude, azimuth = Horizontal(equatorial(lambda, beta, obliquity(n)), latitude, longitude, t)
+	return altitude - parallax*math.Cos(deg2rad(altitude)), azimuth
+}
+
+// MoonPhase returns the illuminated fraction of the Moon's disk, 0 at new
+// and 1 at full moon, and the Moon's age in days since new moon
+func MoonPhase(t time.Time) (illumination, age float64) {
+	moonLambda, _, _, _ := moonEcliptic(t)
+	sunLambda, _ := sunEcliptic(t)
+	elongation := normalize360(moonLambda - sunLambda)
+	// The phase angle is close to 180° minus the elongation
+	illumination = (1 - math.Cos(deg2rad(elongation))) / 2
+	return illumination, elongation / 360 * SynodicMonth
+}
@@ -0,0 +1,29 @@
+package ephemeris
+
+import (
+	"math"
+	"time"
+
+	"github.com/tps193/balcony-stargazer/internal/spatial"
+)
+
+// sunEcliptic returns the Sun's ecliptic longitude in degrees and the days
+// since J2000
+func sunEcliptic(t time.Time) (lambda, n float64) {
+	n = julianDate(t) - j2000
+	L := normalize360(280.460 + 0.9856474*n)
+	g := deg2rad(normalize360(357.528 + 0.9856003*n))
+	return normalize360(L + 1.915*math.Sin(g) + 0.020*math.Sin(2*g)), n
+}
+
+// Sun returns the apparent equatorial position of the Sun
+func Sun(t time.Time) spatial.Point {
+	lambda, n := sunEcliptic(t)
+	return equatorial(lambda, 0, obliquity(n))
+}
+
+// SunAltitude returns the altitude of the Sun's center in degrees
+func SunAltitude(latitude, longitude float64, t time.Time) float64 {
+	alt, _ := Horizontal(Sun(t), latitude, longitude, t)
+	return alt
+}
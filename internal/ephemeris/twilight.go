@@ -0,0 +1,120 @@
+package ephemeris
+
+import (
+	"fmt"
+	"time"
+)
+
+// Darkness is the Sun altitude below which the sky counts as dark enough
+type Darkness string
+
+const (
+	DarknessCivil        Darkness = "civil"
+	DarknessNautical     Darkness = "nautical"
+	DarknessAstronomical Darkness = "astronomical"
+)
+
+// SunAltitude returns the Sun altitude ending dusk and starting dawn
+func (d Darkness) SunAltitude() float64 {
+	switch d {
+	case DarknessCivil:
+		return -6
+	case DarknessNautical:
+		return -12
+	default:
+		return -18
+	}
+}
+
+// ParseDarkness parses civil, nautical or astronomical
+func ParseDarkness(s string) (Darkness, error) {
+	switch d := Darkness(s); d {
+	case DarknessCivil, DarknessNautical, DarknessAstronomical:
+		return d, nil
+	}
+	return "", fmt.Errorf("unknown darkness level %q, expected civil, nautical or astronomical", s)
+}
+
+// Night is the dark part of the night starting on a date, from dusk to dawn.
+// In polar summer there is no dark time and Dusk and Dawn are zero; in polar
+// night the whole noon to noon span is dark.
+type Night struct {
+	Date time.Time `json:"date"`
+	Dusk time.Time `json:"dusk"`
+	Dawn time.Time `json:"dawn"`
+}
+
+// IsDark reports whether the night has dark time
+func (n *Night) IsDark() bool {
+	return n.Dawn.After(n.Dusk)
+}
+
+// scanStep is the sampling interval used to find Sun altitude crossings
+const scanStep = 10 * time.Minute
+
+// DarkNight finds dusk and dawn at the darkness level for the night starting
+// on the given date in the location. The search runs from local noon of the
+// date to local noon of the next day, so daylight saving changes are handled
+// by the time zone.
+func DarkNight(latitude, longitude float64, date time.Time, location *time.Location, darkness Darkness) Night {
+	year, month, day := date.Date()
+	noon := time.Date(year, month, day, 12, 0, 0, 0, location)
+	nextNoon := time.Date(year, month, day+1, 12, 0, 0, 0, location)
+	threshold := darkness.SunAltitude()
+	isDark := func(t time.Time) bool {
+		return SunAltitude(latitude, longitude, t) < threshold
+	}
+
+	night := Night{Date: time.Date(year, month, day, 0, 0, 0, 0, location)}
+	dark := isDark(noon)
+	if dark {
+		night.Dusk = noon
+	}
+	for t := noon; t.Before(nextNoon); t = t.Add(scanStep) {
+		next := t.Add(scanStep)
+		if next.After(nextNoon) {
+			next = nextNoon
+		}
+		nextDark := isDark(next)
+		if nextDark != dark {
+			crossing := refineCrossing(t, next, isDark)
+			if nextDark && night.Dusk.IsZero() {
+				night.Dusk = crossing
+			} else if !nextDark && !night.Dusk.IsZero() && night.Dawn.IsZero() {
+				night.Dawn = crossing
+			}
+		}
+		dark = nextDark
+	}
+	if !night.Dusk.IsZero() && night.Dawn.IsZero() {
+		night.Dawn = nextNoon
+	}
+	return night
+}
+
+// refineCrossing bisects the interval in which isDark changes to a second
+func refineCrossing(from, to time.Time, isDark func(time.Time) bool) time.Time {
+	fromDark := isDark(from)
+	for to.Sub(from) > time.Second {
+		middle := from.Add(to.Sub(from) / 2)
+		if isDark(middle) == fromDark {
+			from = middle
+		} else {
+			to = middle
+		}
+	}
+	return to.Truncate(time.Second).In(from.Location())
+}
+
+// DarkNights returns the nights starting on every date from from to to,
+// both included
+func DarkNights(latitude, longitude float64, from, to time.Time, location *time.Location, darkness Darkness) []Night {
+	var nights []Night
+	fy, fm, fd := from.Date()
+	ty, tm, td := to.Date()
+	last := time.Date(ty, tm, td, 0, 0, 0, 0, time.UTC)
+	for date := time.Date(fy, fm, fd, 0, 0, 0, 0, time.UTC); !date.After(last); date = date.AddDate(0, 0, 1) {
+		nights = append(nights, DarkNight(latitude, longitude, date, location, darkness))
+	}
+	return nights
+}
@@ -0,0 +1,79 @@
+// Package logging provides leveled, per-subsystem loggers built on log/slog.
+//
+// Loggers returned by New can be created at package initialization time; the
+// level and output configured later through SetLevel and SetOutput apply to
+// all of them.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+var (
+	level = new(slog.LevelVar)
+	base  atomic.Pointer[slog.Handler]
+)
+
+func init() {
+	SetOutput(os.Stderr)
+}
+
+// SetOutput directs all subsystem loggers to w using the text format.
+func SetOutput(w io.Writer) {
+	var h slog.Handler = slog.NewTextHandler(w, &slog.HandlerOptions{Level: level})
+	base.Store(&h)
+}
+
+// SetLevel sets the minimum level for all subsystem loggers.
+func SetLevel(l slog.Level) {
+	level.Set(l)
+}
+
+// ParseLevel parses a level name such as "debug", "info", "warn" or "error".
+func ParseLevel(s string) (slog.Level, error) {
+	var l slog.Level
+	err := l.UnmarshalText([]byte(strings.TrimSpace(s)))
+	return l, err
+}
+
+// New returns a logger tagged with the given subsystem name.
+func New(subsystem string) *slog.Logger {
+	return slog.New(&handler{}).With("subsystem", subsystem)
+}
+
+// handler resolves the shared base handler at log time so that loggers
+// created before SetOutput still write to the configured destination.
+type handler struct {
+	wrap []func(slog.Handler) slog.Handler
+}
+
+func (h *handler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= level.Level()
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	b := *base.Load()
+	for _, w := range h.wrap {
+		b = w(b)
+	}
+	return b.Handle(ctx, r)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(b slog.Handler) slog.Handler { return b.WithAttrs(attrs) })
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return h.with(func(b slog.Handler) slog.Handler { return b.WithGroup(name) })
+}
+
+func (h *handler) with(w func(slog.Handler) slog.Handler) *handler {
+	wrap := make([]func(slog.Handler) slog.Handler, len(h.wrap), len(h.wrap)+1)
+	copy(wrap, h.wrap)
+	return &handler{wrap: append(wrap, w)}
+}
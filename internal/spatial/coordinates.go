@@ -0,0 +1,154 @@
+package spatial
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Point is an equatorial position in degrees.
+type Point struct {
+	RA  float64 `json:"ra"`
+	Dec float64 `json:"dec"`
+}
+
+func deg2rad(deg float64) float64 {
+	return deg * math.Pi / 180.0
+}
+
+func rad2deg(rad float64) float64 {
+	return rad * 180.0 / math.Pi
+}
+
+func normalize360(deg float64) float64 {
+	deg = math.Mod(deg, 360)
+	if deg < 0 {
+		deg += 360
+	}
+	return deg
+}
+
+// Separation returns the angular distance between a and b in degrees.
+func Separation(a, b Point) float64 {
+	// Haversine formula, stable for small separations
+	ra1, dec1 := deg2rad(a.RA), deg2rad(a.Dec)
+	ra2, dec2 := deg2rad(b.RA), deg2rad(b.Dec)
+	sinDDec := math.Sin((dec2 - dec1) / 2)
+	sinDRA := math.Sin((ra2 - ra1) / 2)
+	h := sinDDec*sinDDec + math.Cos(dec1)*math.Cos(dec2)*sinDRA*sinDRA
+	return rad2deg(2 * math.Asin(math.Min(1, math.Sqrt(h))))
+}
+
+// PositionAngle returns the position angle of to as seen from from, in
+// degrees measured from north through east.
+func PositionAngle(from, to Point) float64 {
+	dec1, dec2 := deg2rad(from.Dec), deg2rad(to.Dec)
+	dRA := deg2rad(to.RA - from.RA)
+	y := math.Sin(dRA)
+	x := math.Cos(dec1)*math.Tan(dec2) - math.Sin(dec1)*math.Cos(dRA)
+	return normalize360(rad2deg(math.Atan2(y, x)))
+}
+
+// Destination returns the point at the given separation and position angle
+// from the start point, both in degrees.
+func Destination(from Point, separation, positionAngle float64) Point {
+	ra1, dec1 := deg2rad(from.RA), deg2rad(from.Dec)
+	d, pa := deg2rad(separation), deg2rad(positionAngle)
+	dec2 := math.Asin(math.Sin(dec1)*math.Cos(d) + math.Cos(dec1)*math.Sin(d)*math.Cos(pa))
+	ra2 := ra1 + math.Atan2(math.Sin(pa)*math.Sin(d)*math.Cos(dec1), math.Cos(d)-math.Sin(dec1)*math.Sin(dec2))
+	return Point{RA: normalize360(rad2deg(ra2)), Dec: rad2deg(dec2)}
+}
+
+// ParseRA parses right ascension given either as sexagesimal hours
+// ("05:35:17.3") or as decimal degrees ("83.82") and returns degrees.
+func ParseRA(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, ":") {
+		hours, err := parseSexagesimal(s)
+		if err != nil {
+			return 0, fmt.Errorf("RA string should have format HH:MM:SS.ss, got: %s", s)
+		}
+		return normalize360(hours * 15), nil
+	}
+	deg, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse RA %q: %w", s, err)
+	}
+	return normalize360(deg), nil
+}
+
+// ParseDec parses declination given either as sexagesimal degrees
+// ("-05:23:28") or as decimal degrees ("-5.39") and returns degrees.
+func ParseDec(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	var deg float64
+	var err error
+	if strings.Contains(s, ":") {
+		deg, err = parseSexagesimal(s)
+		if err != nil {
+			return 0, fmt.Errorf("Dec string should have format [+/-]DD:MM:SS.ss, got: %s", s)
+		}
+	} else {
+		deg, err = strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse Dec %q: %w", s, err)
+		}
+	}
+	if deg < -90 || deg > 90 {
+		return 0, fmt.Errorf("declination %s is outside of [-90, 90]", s)
+	}
+	return deg, nil
+}
+
+// parseSexagesimal parses "[+/-]A:B:C" into A + B/60 + C/3600 with the sign
+// applied to the whole value.
+func parseSexagesimal(s string) (float64, error) {
+	sign := 1.0
+	if strings.HasPrefix(s, "-") {
+		sign = -1.0
+		s = s[1:]
+	} else if strings.HasPrefix(s, "+") {
+		s = s[1:]
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("expected 3 components, got %d", len(parts))
+	}
+	value := 0.0
+	scale := 1.0
+	for _, part := range parts {
+		f, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return 0, err
+		}
+		value += f / scale
+		scale *= 60
+	}
+	return sign * value, nil
+}
+
+// ParsePolygon parses vertices written as "ra,dec;ra,dec;..." where every
+// coordinate is accepted by ParseRA or ParseDec.
+func ParsePolygon(s string) ([]Point, error) {
+	var vertices []Point
+	for _, vertex := range strings.Split(s, ";") {
+		if strings.TrimSpace(vertex) == "" {
+			continue
+		}
+		coords := strings.Split(vertex, ",")
+		if len(coords) != 2 {
+			return nil, fmt.Errorf("polygon vertex should have format ra,dec, got: %s", vertex)
+		}
+		ra, err := ParseRA(coords[0])
+		if err != nil {
+			return nil, err
+		}
+		dec, err := ParseDec(coords[1])
+		if err != nil {
+			return nil, err
+		}
+		vertices = append(vertices, Point{RA: ra, Dec: dec})
+	}
+	return vertices, nil
+}
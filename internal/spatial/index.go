@@ -0,0 +1,197 @@
+// Package spatial provides positional queries over points on the celestial
+// sphere.
+package spatial
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// DefaultCellSize is the declination band height and the approximate RA cell
+// width, in degrees, used by NewIndex when no cell size is given.
+const DefaultCellSize = 1.0
+
+// Index is a declination-banded RA grid. Every band covers cellSize degrees
+// of declination and is split into RA cells roughly cellSize degrees wide at
+// the band's equator-most edge, so cells stay close to square away from the
+// poles.
+type Index struct {
+	points   []Point
+	cellSize float64
+	bands    []band
+}
+
+type band struct {
+	cells [][]int
+}
+
+// Match is a point found by a query. Index refers to the position of the
+// point in the slice given to NewIndex. Separation and PositionAngle are
+// measured from the query center, in degrees.
+type Match struct {
+	Index         int     `json:"index"`
+	Separation    float64 `json:"separation"`
+	PositionAngle float64 `json:"positionAngle"`
+}
+
+// NewIndex builds an index over points. A non-positive cellSize selects
+// DefaultCellSize.
+func NewIndex(points []Point, cellSize float64) *Index {
+	if cellSize <= 0 {
+		cellSize = DefaultCellSize
+	}
+	idx := &Index{
+		points:   points,
+		cellSize: cellSize,
+		bands:    make([]band, int(math.Ceil(180/cellSize))),
+	}
+	for b := range idx.bands {
+		lower := -90 + float64(b)*cellSize
+		upper := math.Min(90, lower+cellSize)
+		widest := math.Min(math.Abs(lower), math.Abs(upper))
+		if lower < 0 && upper > 0 {
+			widest = 0
+		}
+		n := int(math.Ceil(360 * math.Cos(deg2rad(widest)) / cellSize))
+		idx.bands[b].cells = make([][]int, max(1, n))
+	}
+	for i, p := range points {
+		cells := idx.bands[idx.bandOf(p.Dec)].cells
+		c := cellOf(cells, p.RA)
+		cells[c] = append(cells[c], i)
+	}
+	return idx
+}
+
+// Cone returns all points within radius degrees of center, closest first.
+func (idx *Index) Cone(center Point, radius float64) []Match {
+	if radius < 0 {
+		return nil
+	}
+	decMin := math.Max(-90, center.Dec-radius)
+	decMax := math.Min(90, center.Dec+radius)
+
+	// RA half-width of the cap; the whole band when the cap covers a pole
+	raHalfWidth := 180.0
+	if decMin > -90 && decMax < 90 {
+		s := math.Sin(deg2rad(radius)) / math.Cos(deg2rad(center.Dec))
+		if s < 1 {
+			raHalfWidth = rad2deg(math.Asin(s))
+		}
+	}
+
+	var matches []Match
+	for b := idx.bandOf(decMin); b <= idx.bandOf(decMax); b++ {
+		idx.visitCells(idx.bands[b].cells, center.RA, raHalfWidth, func(i int) {
+			sep := Separation(center, idx.points[i])
+			if sep <= radius {
+				m := Match{Index: i, Separation: sep}
+				if sep > 0 {
+					m.PositionAngle = PositionAngle(center, idx.points[i])
+				}
+				matches = append(matches, m)
+			}
+		})
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Separation < matches[j].Separation
+	})
+	return matches
+}
+
+// Polygon returns all points inside the spherical polygon whose vertices are
+// joined by great-circle arcs. The polygon must fit inside a hemisphere.
+// Separation and position angle are measured from the polygon's centroid,
+// which is returned as well.
+func (idx *Index) Polygon(vertices []Point) ([]Match, Point, error) {
+	if len(vertices) < 3 {
+		return nil, Point{}, errors.New("polygon needs at least 3 vertices")
+	}
+	center := centroid(vertices)
+	radius := 0.0
+	for _, v := range vertices {
+		radius = math.Max(radius, Separation(center, v))
+	}
+	if radius >= 90 {
+		return nil, center, errors.New("polygon must fit inside a hemisphere")
+	}
+
+	// The gnomonic projection maps great circles to straight lines, so the
+	// point-in-polygon test can be done in the tangent plane.
+	xs := make([]float64, len(vertices))
+	ys := make([]float64, len(vertices))
+	for i, v := range vertices {
+		xs[i], ys[i] = gnomonic(center, v)
+	}
+	var matches []Match
+	for _, m := range idx.Cone(center, radius) {
+		x, y := gnomonic(center, idx.points[m.Index])
+		if insidePolygon(xs, ys, x, y) {
+			matches = append(matches, m)
+		}
+	}
+	return matches, center, nil
+}
+
+func (idx *Index) bandOf(dec float64) int {
+	b := int((dec + 90) / idx.cellSize)
+	return min(max(b, 0), len(idx.bands)-1)
+}
+
+func cellOf(cells [][]int, ra float64) int {
+	c := int(normalize360(ra) / 360 * float64(len(cells)))
+	return min(c, len(cells)-1)
+}
+
+// visitCells calls fn for every point in the cells overlapping
+// [ra-halfWidth, ra+halfWidth], handling the wrap at 0h.
+func (idx *Index) visitCells(cells [][]int, ra, halfWidth float64, fn func(int)) {
+	n := len(cells)
+	first, count := 0, n
+	if halfWidth < 180 {
+		cellWidth := 360 / float64(n)
+		first = cellOf(cells, ra-halfWidth)
+		count = min(n, int(math.Ceil(2*halfWidth/cellWidth))+1)
+	}
+	for k := 0; k < count; k++ {
+		for _, i := range cells[(first+k)%n] {
+			fn(i)
+		}
+	}
+}
+
+func centroid(vertices []Point) Point {
+	var x, y, z float64
+	for _, v := range vertices {
+		ra, dec := deg2rad(v.RA), deg2rad(v.Dec)
+		x += math.Cos(dec) * math.Cos(ra)
+		y += math.Cos(dec) * math.Sin(ra)
+		z += math.Sin(dec)
+	}
+	return Point{
+		RA:  normalize360(rad2deg(math.Atan2(y, x))),
+		Dec: rad2deg(math.Atan2(z, math.Hypot(x, y))),
+	}
+}
+
+// gnomonic projects p onto the plane tangent to the sphere at center.
+func gnomonic(center, p Point) (float64, float64) {
+	dec0, dec := deg2rad(center.Dec), deg2rad(p.Dec)
+	dRA := deg2rad(p.RA - center.RA)
+	cosC := math.Sin(dec0)*math.Sin(dec) + math.Cos(dec0)*math.Cos(dec)*math.Cos(dRA)
+	x := math.Cos(dec) * math.Sin(dRA) / cosC
+	y := (math.Cos(dec0)*math.Sin(dec) - math.Sin(dec0)*math.Cos(dec)*math.Cos(dRA)) / cosC
+	return x, y
+}
+
+// insidePolygon is the even-odd ray casting test.
+func insidePolygon(xs, ys []float64, x, y float64) bool {
+	inside := false
+	for i, j := 0, len(xs)-1; i < len(xs); j, i = i, i+1 {
+		if (ys[i] > y) != (ys[j] > y) && x < (xs[j]-xs[i])*(y-ys[i])/(ys[j]-ys[i])+xs[i] {
+			inside = !inside
+		}
+	}
+	return inside
+}
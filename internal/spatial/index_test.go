@@ -0,0 +1,110 @@
+package spatial
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func randomPoints(n int) []Point {
+	r := rand.New(rand.NewSource(1))
+	points := make([]Point, n)
+	for i := range points {
+		points[i] = Point{RA: r.Float64() * 360, Dec: rad2deg(math.Asin(2*r.Float64() - 1))}
+	}
+	return points
+}
+
+func TestConeMatchesBruteForce(t *testing.T) {
+	points := randomPoints(5000)
+	idx := NewIndex(points, 0)
+	tests := []struct {
+		name   string
+		center Point
+		radius float64
+	}{
+		{"equator", Point{RA: 83.8, Dec: -5.4}, 2},
+		{"wrap at 0h", Point{RA: 359.5, Dec: 10}, 5},
+		{"near pole", Point{RA: 120, Dec: 88}, 4},
+		{"large", Point{RA: 200, Dec: 30}, 40},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := 0
+			for _, p := range points {
+				if Separation(tt.center, p) <= tt.radius {
+					want++
+				}
+			}
+			got := idx.Cone(tt.center, tt.radius)
+			if len(got) != want {
+				t.Fatalf("got %d matches, want %d", len(got), want)
+			}
+			for i := 1; i < len(got); i++ {
+				if got[i].Separation < got[i-1].Separation {
+					t.Fatalf("matches are not sorted by separation")
+				}
+			}
+		})
+	}
+}
+
+func TestPolygon(t *testing.T) {
+	points := []Point{
+		{RA: 10, Dec: 10},  // inside
+		{RA: 359, Dec: 1},  // inside, across 0h
+		{RA: 20, Dec: 10},  // outside
+		{RA: 10, Dec: -10}, // outside
+	}
+	idx := NewIndex(points, 0)
+	square := []Point{{RA: 355, Dec: -5}, {RA: 15, Dec: -5}, {RA: 15, Dec: 15}, {RA: 355, Dec: 15}}
+	matches, _, err := idx.Polygon(square)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := map[int]bool{}
+	for _, m := range matches {
+		found[m.Index] = true
+	}
+	if len(found) != 2 || !found[0] || !found[1] {
+		t.Errorf("expected points 0 and 1 inside the polygon, got %v", matches)
+	}
+}
+
+func TestPositionAngle(t *testing.T) {
+	center := Point{RA: 100, Dec: 20}
+	if pa := PositionAngle(center, Point{RA: 100, Dec: 21}); math.Abs(pa) > 1e-9 && math.Abs(pa-360) > 1e-9 {
+		t.Errorf("north should be 0°, got %f", pa)
+	}
+	if pa := PositionAngle(center, Point{RA: 101, Dec: 20}); math.Abs(pa-90) > 1 {
+		t.Errorf("east should be ~90°, got %f", pa)
+	}
+}
+
+func TestDestination(t *testing.T) {
+	center := Point{RA: 359.5, Dec: 60}
+	for _, pa := range []float64{10, 95, 200, 300} {
+		p := Destination(center, 1.5, pa)
+		if sep := Separation(center, p); math.Abs(sep-1.5) > 1e-9 {
+			t.Errorf("PA %v: separation %f, want 1.5", pa, sep)
+		}
+		if got := PositionAngle(center, p); math.Abs(got-pa) > 1e-6 {
+			t.Errorf("PA %v: got position angle %f", pa, got)
+		}
+	}
+}
+
+func TestParseCoordinates(t *testing.T) {
+	ra, err := ParseRA("05:35:16.48")
+	if err != nil || math.Abs(ra-83.8187) > 1e-3 {
+		t.Errorf("ParseRA = %f, %v", ra, err)
+	}
+	dec, err := ParseDec("-05:23:22.8")
+	if err != nil || math.Abs(dec+5.3897) > 1e-3 {
+		t.Errorf("ParseDec = %f, %v", dec, err)
+	}
+	dec, err = ParseDec("-00:30:00")
+	if err != nil || math.Abs(dec+0.5) > 1e-9 {
+		t.Errorf("ParseDec = %f, %v", dec, err)
+	}
+}
@@ -0,0 +1,64 @@
+package visibility
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ExtinctionCoefficients are typical extinction coefficients in magnitudes
+// per airmass for a good site, by photometric band
+var ExtinctionCoefficients = map[string]float64{
+	"U": 0.55,
+	"B": 0.30,
+	"V": 0.20,
+	"R": 0.12,
+	"I": 0.08,
+}
+
+// Airmass returns the relative optical path length through the atmosphere at
+// the given altitude in degrees (Kasten and Young 1989). Altitudes below the
+// horizon are taken at the horizon.
+func Airmass(altitude float64) float64 {
+	altitude = math.Max(altitude, 0)
+	return 1 / (math.Sin(Deg2rad(altitude)) + 0.50572*math.Pow(altitude+6.07995, -1.6364))
+}
+
+// Extinction is the dimming of the object by the atmosphere during a window
+// in magnitudes
+type Extinction struct {
+	Band string `json:"band"`
+	// AtPeak is the extinction at the highest point of the window, Max at the
+	// lowest
+	AtPeak float64 `json:"atPeak"`
+	Max    float64 `json:"max"`
+}
+
+// ExtinctionCoefficient looks up the coefficient of a band, ignoring case
+func ExtinctionCoefficient(band string) (float64, error) {
+	coefficient, ok := ExtinctionCoefficients[strings.ToUpper(band)]
+	if !ok {
+		return 0, fmt.Errorf("unknown band %q, expected U, B, V, R or I", band)
+	}
+	return coefficient, nil
+}
+
+// AnalyzeExtinction fills in the extinction in the band for every visibility
+// window from its airmass range
+func AnalyzeExtinction(infos []VisibilityInfo, band string) error {
+	coefficient, err := ExtinctionCoefficient(band)
+	if err != nil {
+		return err
+	}
+	for i := range infos {
+		for j := range infos[i].VisibilityWindows {
+			window := &infos[i].VisibilityWindows[j]
+			window.Extinction = &Extinction{
+				Band:   strings.ToUpper(band),
+				AtPeak: coefficient * window.MinAirmass,
+				Max:    coefficient * window.MaxAirmass,
+			}
+		}
+	}
+	return nil
+}
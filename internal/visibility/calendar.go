@@ -0,0 +1,236 @@
+package visibility
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"html"
+	"strconv"
+	"time"
+
+	"github.com/tps193/balcony-stargazer/internal/ephemeris"
+)
+
+// seasonThreshold is the part of an object's best night that a night needs
+// to belong to its imaging season
+const seasonThreshold = 0.5
+
+// CalendarDay is the visible dark time of an object in the night starting on
+// Date
+type CalendarDay struct {
+	Date     time.Time `json:"date"`
+	Minutes  float64   `json:"minutes"`
+	InSeason bool      `json:"inSeason,omitempty"`
+}
+
+// Season is the best imaging season of an object: the run of consecutive
+// nights, possibly across the new year, with at least half the visible time
+// of the best night and the most visible time in total
+type Season struct {
+	Start         time.Time     `json:"start"`
+	End           time.Time     `json:"end"`
+	Nights        int           `json:"nights"`
+	TotalDuration time.Duration `json:"totalDuration"`
+}
+
+// Calendar holds the visible dark time of an object for every night of a
+// year. Season is nil when the object is never visible in dark time.
+type Calendar struct {
+	Object     AstroObject   `json:"object"`
+	Year       int           `json:"year"`
+	Days       []CalendarDay `json:"days"`
+	MaxMinutes float64       `json:"maxMinutes"`
+	Season     *Season       `json:"season,omitempty"`
+}
+
+// CalculateCalendars finds the visible dark time of every object for every
+// night of the year, with the dark time of the site of the first config
+// that has one
+func CalculateCalendars(astroObjects *AstroObjectArray, configArray *ConfigArray, year int, darkness ephemeris.Darkness, filter Filter) ([]Calendar, error) {
+	from := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	timeRanges, err := configArray.DarkTimeRanges(from, from.AddDate(1, 0, -1), darkness)
+	if err != nil {
+		return nil, err
+	}
+	infos := CalculateAltitudeVisibility(astroObjects, configArray, timeRanges, 5, filter, false)
+	return BuildCalendars(GroupByNight(infos, timeRanges), year), nil
+}
+
+// BuildCalendars turns the nightly visibility into one calendar per object.
+// Nights are matched by their date, also when the dark time starts after
+// midnight.
+func BuildCalendars(nightly []NightlyVisibility, year int) []Calendar {
+	first := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	days := first.AddDate(1, 0, 0).Sub(first).Hours() / 24
+	calendars := make([]Calendar, 0, len(nightly))
+	for _, plan := range nightly {
+		calendar := Calendar{Object: plan.Object, Year: year, Days: make([]CalendarDay, int(days))}
+		minutes := make(map[string]float64, len(plan.Nights))
+		for _, night := range plan.Nights {
+			minutes[nightDate(night.Night.StartTime).Format(time.DateOnly)] += night.TotalDuration.Minutes()
+		}
+		for i := range calendar.Days {
+			date := first.AddDate(0, 0, i)
+			calendar.Days[i] = CalendarDay{Date: date, Minutes: minutes[date.Format(time.DateOnly)]}
+			calendar.MaxMinutes = max(calendar.MaxMinutes, calendar.Days[i].Minutes)
+		}
+		calendar.Season = bestSeason(calendar.Days, calendar.MaxMinutes)
+		calendars = append(calendars, calendar)
+	}
+	return calendars
+}
+
+// bestSeason marks and returns the best season of the days, nil when no day
+// has visible time
+func bestSeason(days []CalendarDay, maxMinutes float64) *Season {
+	if maxMinutes <= 0 {
+		return nil
+	}
+	threshold := seasonThreshold * maxMinutes
+	n := len(days)
+	// Start right after a night outside the season so that a season running
+	// over the new year is found in one piece
+	offset := 0
+	for i, day := range days {
+		if day.Minutes < threshold {
+			offset = i + 1
+			break
+		}
+	}
+	bestStart, bestLength, bestTotal := 0, 0, -1.0
+	start, total := -1, 0.0
+	for k := 0; k <= n; k++ {
+		i := (offset + k) % n
+		if k < n && days[i].Minutes >= threshold {
+			if start < 0 {
+				start, total = k, 0
+			}
+			total += days[i].Minutes
+			continue
+		}
+		if start >= 0 && total > bestTotal {
+			bestStart, bestLength, bestTotal = start, k-start, total
+		}
+		start = -1
+	}
+	for k := bestStart; k < bestStart+bestLength; k++ {
+		days[(offset+k)%n].InSeason = true
+	}
+	return &Season{
+		Start:         days[(offset+bestStart)%n].Date,
+		End:           days[(offset+bestStart+bestLength-1)%n].Date,
+		Nights:        bestLength,
+		TotalDuration: time.Duration(bestTotal * float64(time.Minute)),
+	}
+}
+
+// calendarRamp shades the text calendar from no visible time to the most
+const calendarRamp = " .:-=+*#%@"
+
+// heatLevel returns the shade of the minutes from 0, not visible, to
+// levels-1, the best night
+func heatLevel(minutes, maxMinutes float64, levels int) int {
+	if minutes <= 0 || maxMinutes <= 0 {
+		return 0
+	}
+	return 1 + min(int(minutes/maxMinutes*float64(levels-1)), levels-2)
+}
+
+// GetCalendars draws every calendar as a text heatmap with one row per month
+// and one column per day. The nights of the best season are marked with ^
+// below their month.
+func (output *ConsoleOutput) GetCalendars(calendars []Calendar) string {
+	res := make([]byte, 0)
+	for _, calendar := range calendars {
+		res = fmt.Appendf(res, "Calendar of %s (%s) in %d, visible dark time per night, '%c' up to %.0f minutes:\n", calendar.Object.Name, calendar.Object.ObjectType, calendar.Year, calendarRamp[len(calendarRamp)-1], calendar.MaxMinutes)
+		res = append(res, "     1234567890123456789012345678901\n"...)
+		for month := time.January; month <= time.December; month++ {
+			row := []byte(fmt.Sprintf("%s  ", month.String()[:3]))
+			marks := []byte("     ")
+			for _, day := range calendar.Days {
+				if day.Date.Month() != month {
+					continue
+				}
+				row = append(row, calendarRamp[heatLevel(day.Minutes, calendar.MaxMinutes, len(calendarRamp))])
+				if day.InSeason {
+					marks = append(marks, '^')
+				} else {
+					marks = append(marks, ' ')
+				}
+			}
+			res = append(append(res, bytes.TrimRight(row, " ")...), '\n')
+			if marks := bytes.TrimRight(marks, " "); len(marks) > 0 {
+				res = append(append(res, marks...), '\n')
+			}
+		}
+		if season := calendar.Season; season != nil {
+			res = fmt.Appendf(res, "Best season: %s - %s, %d nights, %s\n", season.Start.Format("Jan 2"), season.End.Format("Jan 2"), season.Nights, season.TotalDuration)
+		} else {
+			res = fmt.Appendf(res, "Never visible in dark time\n")
+		}
+	}
+	return string(res)
+}
+
+// CalendarCSV writes one line per object and night with the visible minutes
+// and whether the night is in the best season
+func CalendarCSV(calendars []Calendar) (string, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write([]string{"object", "date", "minutes", "inSeason"})
+	for _, calendar := range calendars {
+		for _, day := range calendar.Days {
+			writer.Write([]string{calendar.Object.Name, day.Date.Format(time.DateOnly), strconv.FormatFloat(day.Minutes, 'f', 0, 64), strconv.FormatBool(day.InSeason)})
+		}
+	}
+	writer.Flush()
+	return buf.String(), writer.Error()
+}
+
+const (
+	svgCell       = 14
+	svgLabelWidth = 36
+	svgTitle      = 24
+	svgLevels     = 9
+)
+
+// CalendarSVG draws the calendars below each other as an SVG heatmap. Nights
+// of the best season are outlined.
+func CalendarSVG(calendars []Calendar) string {
+	blockHeight := svgTitle + 12*svgCell + svgCell
+	width := svgLabelWidth + 31*svgCell + svgCell
+	res := fmt.Appendf(nil, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="11">`+"\n", width, blockHeight*len(calendars))
+	for i, calendar := range calendars {
+		top := i * blockHeight
+		title := fmt.Sprintf("%s %d: up to %.0f min per night", calendar.Object.Name, calendar.Year, calendar.MaxMinutes)
+		if season := calendar.Season; season != nil {
+			title += fmt.Sprintf(", best season %s - %s", season.Start.Format("Jan 2"), season.End.Format("Jan 2"))
+		}
+		res = fmt.Appendf(res, `<text x="0" y="%d" font-size="13">%s</text>`+"\n", top+16, html.EscapeString(title))
+		for month := time.January; month <= time.December; month++ {
+			res = fmt.Appendf(res, `<text x="0" y="%d">%s</text>`+"\n", top+svgTitle+int(month-1)*svgCell+11, month.String()[:3])
+		}
+		for _, day := range calendar.Days {
+			x := svgLabelWidth + (day.Date.Day()-1)*svgCell
+			y := top + svgTitle + int(day.Date.Month()-1)*svgCell
+			res = fmt.Appendf(res, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"`, x, y, svgCell-2, svgCell-2, heatColor(heatLevel(day.Minutes, calendar.MaxMinutes, svgLevels)))
+			if day.InSeason {
+				res = append(res, ` stroke="#e66100" stroke-width="2"`...)
+			}
+			res = fmt.Appendf(res, `><title>%s: %.0f min</title></rect>`+"\n", day.Date.Format(time.DateOnly), day.Minutes)
+		}
+	}
+	res = append(res, "</svg>\n"...)
+	return string(res)
+}
+
+// heatColor shades from light grey for no visible time through light to
+// dark green for the best night
+func heatColor(level int) string {
+	if level == 0 {
+		return "#ebedf0"
+	}
+	f := float64(level-1) / float64(svgLevels-2)
+	lerp := func(from, to int) int { return from + int(f*float64(to-from)) }
+	return fmt.Sprintf("#%02x%02x%02x", lerp(0xc6, 0x19), lerp(0xe4, 0x61), lerp(0x8b, 0x27))
+}
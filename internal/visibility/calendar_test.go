@@ -0,0 +1,73 @@
+package visibility
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tps193/balcony-stargazer/internal/ephemeris"
+)
+
+func TestBuildCalendars(t *testing.T) {
+	// A winter object visible from November to February, with a short
+	// spell in June that is too weak to count as its season
+	var nights []NightVisibility
+	for day := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC); day.Year() == 2025; day = day.AddDate(0, 0, 1) {
+		var minutes time.Duration
+		switch day.Month() {
+		case time.November, time.December, time.January, time.February:
+			minutes = 120
+		case time.June:
+			minutes = 30
+		}
+		nights = append(nights, NightVisibility{Night: TimeRange{StartTime: day.Add(20 * time.Hour)}, TotalDuration: minutes * time.Minute})
+	}
+	calendars := BuildCalendars([]NightlyVisibility{{Object: AstroObject{Name: "M42"}, Nights: nights}}, 2025)
+	if len(calendars) != 1 || len(calendars[0].Days) != 365 {
+		t.Fatalf("expected 365 days, got %+v", calendars)
+	}
+	calendar := calendars[0]
+	season := calendar.Season
+	if season == nil || season.Start.Month() != time.November || season.End.Month() != time.February || season.Nights != 30+31+31+28 {
+		t.Fatalf("season %+v, want November to February across the new year", season)
+	}
+	if !calendar.Days[0].InSeason || calendar.Days[160].InSeason {
+		t.Errorf("expected January in season and June not")
+	}
+
+	csv, err := CalendarCSV(calendars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "object,date,minutes,inSeason\nM42,2025-01-01,120,true\n"; !strings.HasPrefix(csv, want) {
+		t.Errorf("csv starts with %q, want %q", csv[:len(want)], want)
+	}
+
+	never := BuildCalendars([]NightlyVisibility{{Object: AstroObject{Name: "never"}}}, 2024)
+	if len(never[0].Days) != 366 || never[0].Season != nil {
+		t.Errorf("expected a leap year without a season, got %d days and %+v", len(never[0].Days), never[0].Season)
+	}
+
+	// In June astronomical dusk in Brest is after midnight; the nights still
+	// belong to the date they begin on
+	brest := ConfigArray{
+		Sites:   []Site{{Name: "brest", Latitude: 48.4, Longitude: -4.5, Timezone: "Europe/Paris"}},
+		Configs: []Config{{Site: "brest"}},
+	}
+	if err := brest.ResolveSites(); err != nil {
+		t.Fatal(err)
+	}
+	june := time.Date(2025, 6, 9, 0, 0, 0, 0, time.UTC)
+	timeRanges, err := brest.DarkTimeRanges(june, june.AddDate(0, 0, 1), ephemeris.DarknessAstronomical)
+	if err != nil || len(timeRanges) != 2 || timeRanges[1].StartTime.Day() != 11 {
+		t.Fatalf("time ranges %+v (%v), want dark time from 2025-06-11 after midnight", timeRanges, err)
+	}
+	nights = nil
+	for _, timeRange := range timeRanges {
+		nights = append(nights, NightVisibility{Night: timeRange, TotalDuration: time.Hour})
+	}
+	days := BuildCalendars([]NightlyVisibility{{Object: AstroObject{Name: "M13"}, Nights: nights}}, 2025)[0].Days
+	if days[159].Minutes != 60 || days[160].Minutes != 60 || days[161].Minutes != 0 {
+		t.Errorf("minutes on June 9 to 11: %v, %v, %v, want 60, 60, 0", days[159].Minutes, days[160].Minutes, days[161].Minutes)
+	}
+}
@@ -0,0 +1,116 @@
+package visibility
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+)
+
+type ClearanceStatus string
+
+// DefaultMaxVignettingPercent is the Filter.MaxVignettingPercent used when
+// none is given: a step counts as visible while at least half of the
+// aperture sees the sky.
+const DefaultMaxVignettingPercent = 50
+
+const (
+	ClearanceClear     ClearanceStatus = "clear"
+	ClearanceVignetted ClearanceStatus = "vignetted"
+	ClearanceBlocked   ClearanceStatus = "blocked"
+)
+
+// Clearance describes how much of the telescope aperture sees the sky at a
+// given altitude and azimuth.
+type Clearance struct {
+	Status           ClearanceStatus `json:"status"`
+	VignettedPercent float64         `json:"vignettedPercent"`
+}
+
+// String reports the clearance as "fully clear", "partially vignetted (x%)"
+// or "blocked"
+func (c Clearance) String() string {
+	switch c.Status {
+	case ClearanceBlocked:
+		return "blocked"
+	case ClearanceVignetted:
+		return fmt.Sprintf("partially vignetted (%.1f%%)", c.VignettedPercent)
+	}
+	return "fully clear"
+}
+
+// worst returns the clearance with the larger part of the aperture covered.
+// The zero Clearance counts as fully clear.
+func (c Clearance) worst(other Clearance) Clearance {
+	if other.VignettedPercent > c.VignettedPercent || c.Status == "" {
+		return other
+	}
+	return c
+}
+
+// PartialObstruction is implemented by obstructions that can cover only a
+// part of the aperture, such as a railing edge crossing the objective.
+type PartialObstruction interface {
+	Obstruction
+	// BlockedFraction returns the covered fraction of the aperture in [0, 1]
+	BlockedFraction(altitude, azimuth float64) float64
+}
+
+// TelescopeGeometry describes the optical tube around its pivot, the point at
+// Config.TelescopeHeight. The optical axis of the objective, of diameter
+// ApertureDiameter, runs PivotOffset from the pivot, measured perpendicular
+// to the axis (positive when the tube sits above the altitude axis), so the
+// objective moves towards the balcony as the tube is raised. Lengths use the
+// same unit as the rest of the config.
+type TelescopeGeometry struct {
+	ApertureDiameter float64 `json:"apertureDiameter"`
+	PivotOffset      float64 `json:"pivotOffset"`
+}
+
+// lineOfSight combines all obstructions into the clearance of the aperture.
+// Obstructions that cannot cover the aperture partially block it entirely.
+func lineOfSight(altitude, azimuth float64, obstructions []Obstruction) Clearance {
+	blocked := 0.0
+	for _, o := range obstructions {
+		fraction := 0.0
+		if partial, ok := o.(PartialObstruction); ok {
+			fraction = partial.BlockedFraction(altitude, azimuth)
+		} else if o.Blocks(altitude, azimuth) {
+			fraction = 1
+		}
+		if fraction > 0 && logger.Enabled(context.Background(), slog.LevelDebug) {
+			// Called for every object, config and time step: keep logging behind
+			// the Enabled check so the disabled path does not allocate.
+			logger.Debug("aperture obstructed", "obstruction", o, "fraction", fraction, "altitude", altitude, "azimuth", azimuth)
+		}
+		blocked += fraction
+		if blocked >= 1 {
+			return Clearance{Status: ClearanceBlocked, VignettedPercent: 100}
+		}
+	}
+	if blocked > 0 {
+		return Clearance{Status: ClearanceVignetted, VignettedPercent: blocked * 100}
+	}
+	return Clearance{Status: ClearanceClear}
+}
+
+// segmentFraction returns the fraction of a disk of the given radius lying
+// beyond a straight edge at signed distance s from its center. Positive s
+// means the center is clear of the edge.
+func segmentFraction(s, radius float64) float64 {
+	if radius <= 0 {
+		if s < 0 {
+			return 1
+		}
+		return 0
+	}
+	if s >= radius {
+		return 0
+	}
+	if s <= -radius {
+		return 1
+	}
+	// Area of the circular segment cut off by a chord at distance s
+	area := radius*radius*math.Acos(s/radius) - s*math.Sqrt(radius*radius-s*s)
+	return area / (math.Pi * radius * radius)
+}
@@ -6,8 +6,9 @@ package visibility
 
 import (
 	"fmt"
-	"log"
 	"math"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/tps193/balcony-stargazer/internal/database"
@@ -48,8 +49,8 @@ func greenwichSiderealTime(jd float64) float64 {
 	return normalize360(GST)
 }
 
-// main conversion: RA, Dec, Lat, Lon, Time → Alt, Az
-func radecToAltAz(astroObject AstroObject, position *Position, observationTime time.Time) (altDeg, azDeg float64) {
+// hour angle in degrees in (-180, 180], negative east of the meridian
+func hourAngle(astroObject AstroObject, position *Position, observationTime time.Time) float64 {
 	utc := observationTime.UTC()
 	jd := julianDate(utc)
 	GST := greenwichSiderealTime(jd)
@@ -62,6 +63,12 @@ func radecToAltAz(astroObject AstroObject, position *Position, observationTime t
 	if HA_deg > 180 {
 		HA_deg -= 360
 	}
+	return HA_deg
+}
+
+// main conversion: RA, Dec, Lat, Lon, Time → Alt, Az
+func radecToAltAz(astroObject AstroObject, position *Position, observationTime time.Time) (altDeg, azDeg float64) {
+	HA_deg := hourAngle(astroObject, position, observationTime)
 
 	// Convert to radians
 	HA_rad := Deg2rad(HA_deg)
@@ -98,26 +105,58 @@ func ToAstroObjects(catalogRows []database.CatalogRow) (*AstroObjectArray, error
 		if obj.Commonnames != "" {
 			name = fmt.Sprintf("%s (%s)", obj.Commonnames, obj.Name)
 		}
-		log.Println("Processing object:", name, "RA:", obj.RA, "Dec:", obj.Dec)
 		ra, err := parseCatalogRA(obj.RA)
 		if err != nil {
-			fmt.Println("Error parsing RA:", err)
+			logger.Error("error parsing RA", "object", name, "ra", obj.RA, "err", err)
 			return nil, err
 		}
 		dec, err := parseCatalogDec(obj.Dec)
 		if err != nil {
-			fmt.Println("Error parsing Dec:", err)
+			logger.Error("error parsing Dec", "object", name, "dec", obj.Dec, "err", err)
 			return nil, err
 		}
 		astroObjects.Objects = append(astroObjects.Objects, AstroObject{
-			Name: name,
-			Ra:   ra,
-			Dec:  dec,
+			Name:              name,
+			Ra:                ra,
+			Dec:               dec,
+			MajorAxis:         parseCatalogNumber(obj.MajAx),
+			MinorAxis:         parseCatalogNumber(obj.MinAx),
+			PositionAngle:     parseCatalogNumber(obj.PosAng),
+			SurfaceBrightness: parseCatalogNumber(obj.SurfBr),
 		})
 	}
 	return astroObjects, nil
 }
 
+// raFromDegrees splits a right ascension in degrees into hours, minutes and
+// seconds
+func raFromDegrees(deg float64) RightAscension {
+	hours := normalize360(deg) / 15
+	h := math.Floor(hours)
+	minutes := (hours - h) * 60
+	m := math.Floor(minutes)
+	return RightAscension{Hour: h, Min: m, Sec: (minutes - m) * 60}
+}
+
+// decFromDegrees splits a declination in degrees into degrees, minutes and
+// seconds. The sign is kept on Degree, also when it is -0.
+func decFromDegrees(deg float64) Declination {
+	abs := math.Abs(deg)
+	d := math.Floor(abs)
+	minutes := (abs - d) * 60
+	m := math.Floor(minutes)
+	return Declination{Degree: math.Copysign(d, deg), Min: m, Sec: (minutes - m) * 60}
+}
+
+// parseCatalogNumber parses an optional numeric column, 0 when empty
+func parseCatalogNumber(s string) float64 {
+	value, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
 // parseCatalogRA parses a string like "10:08:28.10" into a RightAscension struct
 func parseCatalogRA(s string) (RightAscension, error) {
 	var ra RightAscension
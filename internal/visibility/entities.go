@@ -1,6 +1,9 @@
 package visibility
 
-import "time"
+import (
+	"math"
+	"time"
+)
 
 const (
 	VESPERA_HEIGHT = 18.00
@@ -8,6 +11,16 @@ const (
 
 type ConfigArray struct {
 	Configs []Config `json:"configs"`
+	// Mounts declares mount profiles referenced by name from the configs
+	Mounts []MountProfile `json:"mounts,omitempty"`
+	// Equipment declares custom equipment profiles used for framing checks
+	Equipment []EquipmentProfile `json:"equipment,omitempty"`
+	// Sites declares observing sites referenced by name from the configs
+	Sites []Site `json:"sites,omitempty"`
+	// Scoring overrides the weights used to rank suggestions
+	Scoring *ScoreWeights `json:"scoring,omitempty"`
+	// Priorities gives objects, by name, a priority from 0 to 10 for ranking
+	Priorities map[string]float64 `json:"priorities,omitempty"`
 }
 
 type Config struct {
@@ -19,6 +32,49 @@ type Config struct {
 	Position          Position `json:"position"`
 	LeftAzimuthLimit  float64  `json:"leftAzimuthLimit"`
 	RightAzimuthLimit float64  `json:"rightAzimuthLimit"`
+	// Site references an observing site by name. Its latitude and longitude
+	// replace Position and times are reported in its time zone.
+	Site string `json:"site,omitempty"`
+	// HorizonMask limits the altitude per azimuth, on its own when
+	// DistanceToFence is 0 or combined with the fence model
+	HorizonMask HorizonMask `json:"horizonMask,omitempty"`
+	// Telescope describes the aperture and pivot offset used to check for
+	// vignetting by the fence and window edges
+	Telescope *TelescopeGeometry `json:"telescope,omitempty"`
+	// Overhang is the slab above the balcony. When set it replaces the fixed
+	// maximum observable altitude.
+	Overhang *Overhang `json:"overhang,omitempty"`
+	// Scene is a 3D model of the balcony checked by line-of-sight ray casting
+	Scene *Scene `json:"scene,omitempty"`
+	// Mount references a mount profile by name
+	Mount string `json:"mount,omitempty"`
+	// PierSides lists the pier sides an equatorial mount can use at this
+	// config, e.g. when the flipped tube would hit the wall; empty allows both
+	PierSides []PierSide `json:"pierSides,omitempty"`
+	// CustomObstructions adds site-specific obstructions to the ones built
+	// from the fields above
+	CustomObstructions []Obstruction `json:"-"`
+
+	mountProfile *MountProfile
+	site         *Site
+}
+
+// hasFence reports whether the fence and window model is configured
+func (config *Config) hasFence() bool {
+	return config.DistanceToFence > 0
+}
+
+func (config *Config) telescopeGeometry() TelescopeGeometry {
+	if config.Telescope == nil {
+		return TelescopeGeometry{}
+	}
+	return *config.Telescope
+}
+
+// hasAzimuthLimits reports whether the azimuth is limited. Equal left and
+// right limits, e.g. both omitted, leave the azimuth unrestricted.
+func (config *Config) hasAzimuthLimits() bool {
+	return config.LeftAzimuthLimit != config.RightAzimuthLimit
 }
 
 type AstroObjectArray struct {
@@ -55,6 +111,14 @@ type AstroObject struct {
 	Ra         RightAscension `json:"ra"`
 	Dec        Declination    `json:"dec"`
 	ObjectType ObjectType     `json:"objectType"`
+	// MajorAxis and MinorAxis are the object's size in arc minutes and
+	// PositionAngle the orientation of the major axis in degrees from north
+	// through east. They are optional and used for framing checks.
+	MajorAxis     float64 `json:"majorAxis,omitempty"`
+	MinorAxis     float64 `json:"minorAxis,omitempty"`
+	PositionAngle float64 `json:"positionAngle,omitempty"`
+	// SurfaceBrightness is the mean surface brightness in mag/arcsec²
+	SurfaceBrightness float64 `json:"surfaceBrightness,omitempty"`
 }
 
 type Position struct {
@@ -83,6 +147,19 @@ type Filter struct {
 	MinVisibilityDurationMinutes int `json:"minVisibilityDurationMinutes"`
 	MinMagnitude                 int `json:"minMagnitude"`
 	MinSizeArcMinutes            int `json:"minSizeArcMinutes"`
+	// MaxVignettingPercent rejects time steps where more of the aperture is
+	// covered; 0 rejects any vignetting and 100 accepts any partially
+	// vignetted step
+	MaxVignettingPercent float64 `json:"maxVignettingPercent"`
+	// MinClearPercent requires this part of an extended object, or of the
+	// frame when Frame is set, to be unobstructed; 0 checks only the center
+	MinClearPercent float64         `json:"minClearPercent"`
+	Frame           *FramingOptions `json:"-"`
+	// MoonAvoidance rejects time steps too close to the Moon
+	MoonAvoidance *MoonAvoidance `json:"moonAvoidance,omitempty"`
+	// MaxAirmass rejects time steps where the object is seen through more
+	// atmosphere; 0 disables the limit
+	MaxAirmass float64 `json:"maxAirmass,omitempty"`
 }
 
 func (ra *RightAscension) toDegree() float64 {
@@ -91,5 +168,9 @@ func (ra *RightAscension) toDegree() float64 {
 }
 
 func (dec *Declination) toDegree() float64 {
+	// The sign of Degree applies to minutes and seconds as well: -5°23' is -5.38°
+	if math.Signbit(dec.Degree) {
+		return dec.Degree - dec.Min/60 - dec.Sec/3600
+	}
 	return dec.Degree + dec.Min/60 + dec.Sec/3600
 }
@@ -0,0 +1,143 @@
+package visibility
+
+import (
+	"fmt"
+	"math"
+)
+
+// EquipmentProfile describes the optics and camera of a telescope. The field
+// of view follows from the focal length and the sensor size.
+type EquipmentProfile struct {
+	Name string `json:"name"`
+	// FocalLength is in millimeters
+	FocalLength float64 `json:"focalLength"`
+	// PixelSize is in micrometers
+	PixelSize      float64 `json:"pixelSize"`
+	SensorWidthPx  int     `json:"sensorWidthPx"`
+	SensorHeightPx int     `json:"sensorHeightPx"`
+}
+
+// BuiltinEquipmentProfiles can be referenced by name without being declared
+// in the config. Declare a profile with the same name in the config to
+// override them.
+var BuiltinEquipmentProfiles = []EquipmentProfile{
+	{Name: "vespera-ii", FocalLength: 250, PixelSize: 2.9, SensorWidthPx: 3840, SensorHeightPx: 2160},
+	{Name: "seestar-s50", FocalLength: 250, PixelSize: 2.9, SensorWidthPx: 1920, SensorHeightPx: 1080},
+	{Name: "dwarf-3", FocalLength: 150, PixelSize: 2.0, SensorWidthPx: 3840, SensorHeightPx: 2160},
+}
+
+// FindEquipment looks the name up in the profiles declared in the config
+// array first and in the built-in profiles second
+func (configArray *ConfigArray) FindEquipment(name string) (*EquipmentProfile, error) {
+	for _, profiles := range [][]EquipmentProfile{configArray.Equipment, BuiltinEquipmentProfiles} {
+		for _, p := range profiles {
+			if p.Name == name {
+				if p.FocalLength <= 0 || p.PixelSize <= 0 || p.SensorWidthPx <= 0 || p.SensorHeightPx <= 0 {
+					return nil, fmt.Errorf("equipment profile %q needs a focal length, pixel size and sensor size", name)
+				}
+				return &p, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("unknown equipment profile %q", name)
+}
+
+// PixelScale returns the sky covered by one pixel in arc seconds
+func (equipment *EquipmentProfile) PixelScale() float64 {
+	return Rad2deg(equipment.PixelSize/1000/equipment.FocalLength) * 3600
+}
+
+// FieldOfView returns the width and height of the frame in arc minutes
+func (equipment *EquipmentProfile) FieldOfView() (width, height float64) {
+	side := func(pixels int) float64 {
+		sensorMm := float64(pixels) * equipment.PixelSize / 1000
+		return Rad2deg(2*math.Atan(sensorMm/(2*equipment.FocalLength))) * 60
+	}
+	return side(equipment.SensorWidthPx), side(equipment.SensorHeightPx)
+}
+
+// Framing tells how an object fits the frame of an equipment profile
+type Framing struct {
+	Equipment       string  `json:"equipment"`
+	FovWidthArcMin  float64 `json:"fovWidthArcMin"`
+	FovHeightArcMin float64 `json:"fovHeightArcMin"`
+	// FillRatio is the object's extent relative to the frame along the
+	// tighter of the two frame axes; above 1 the object does not fit
+	FillRatio   float64 `json:"fillRatio"`
+	NeedsMosaic bool    `json:"needsMosaic"`
+}
+
+// FramingOptions selects the equipment and the frame orientation used for
+// framing checks. Rotation is the position angle of the frame's up
+// direction, 0 for north up. MinFill and MaxFill reject objects filling
+// less or more of the frame; 0 disables them.
+type FramingOptions struct {
+	Equipment *EquipmentProfile
+	Rotation  float64
+	MinFill   float64
+	MaxFill   float64
+}
+
+// Frame returns how the object fits the frame. It reports false for objects
+// without a known size.
+func (options *FramingOptions) Frame(object AstroObject) (Framing, bool) {
+	if object.MajorAxis <= 0 {
+		return Framing{}, false
+	}
+	objectWidth, objectHeight := options.extents(object)
+	width, height := options.Equipment.FieldOfView()
+	fill := math.Max(objectWidth/width, objectHeight/height)
+	return Framing{
+		Equipment:       options.Equipment.Name,
+		FovWidthArcMin:  width,
+		FovHeightArcMin: height,
+		FillRatio:       fill,
+		NeedsMosaic:     fill > 1,
+	}, true
+}
+
+// extents returns the width and height in arc minutes of the object's
+// ellipse along the frame axes
+func (options *FramingOptions) extents(object AstroObject) (width, height float64) {
+	minor := object.MinorAxis
+	if minor <= 0 {
+		minor = object.MajorAxis
+	}
+	a, b := object.MajorAxis/2, minor/2
+	phi := Deg2rad(object.PositionAngle - options.Rotation)
+	sin, cos := math.Sin(phi), math.Cos(phi)
+	return 2 * math.Sqrt(a*a*sin*sin+b*b*cos*cos), 2 * math.Sqrt(a*a*cos*cos+b*b*sin*sin)
+}
+
+// FilterByFraming keeps the objects whose fill ratio is within the limits.
+// Objects without a known size are dropped when a limit is set.
+func FilterByFraming(objects *AstroObjectArray, options FramingOptions) *AstroObjectArray {
+	if options.MinFill <= 0 && options.MaxFill <= 0 {
+		return objects
+	}
+	filtered := &AstroObjectArray{Objects: []AstroObject{}}
+	for _, object := range objects.Objects {
+		framing, ok := options.Frame(object)
+		if !ok {
+			continue
+		}
+		if options.MinFill > 0 && framing.FillRatio < options.MinFill {
+			continue
+		}
+		if options.MaxFill > 0 && framing.FillRatio > options.MaxFill {
+			continue
+		}
+		filtered.Objects = append(filtered.Objects, object)
+	}
+	logger.Debug("filtered by framing", "equipment", options.Equipment.Name, "before", len(objects.Objects), "after", len(filtered.Objects))
+	return filtered
+}
+
+// AnalyzeFraming fills in the framing of every object with a known size
+func AnalyzeFraming(infos []VisibilityInfo, options FramingOptions) {
+	for i := range infos {
+		if framing, ok := options.Frame(infos[i].Object); ok {
+			infos[i].Framing = &framing
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package visibility
+
+import (
+	"math"
+	"time"
+
+	"github.com/tps193/balcony-stargazer/internal/spatial"
+)
+
+// extentGridSize is the number of sample points across each axis of an
+// object's extent or frame
+const extentGridSize = 7
+
+// extentSamples returns points spread over the object's ellipse, or over the
+// frame when the filter checks the frame, used to find the part of an
+// extended object hidden by obstructions. It returns nil when the check is
+// disabled or the object has no known size.
+func extentSamples(object AstroObject, filter *Filter) []AstroObject {
+	if filter.MinClearPercent <= 0 {
+		return nil
+	}
+	// Half extents along the axis at positionAngle and across it, in arc
+	// minutes
+	var along, across, positionAngle float64
+	ellipse := true
+	switch {
+	case filter.Frame != nil && filter.Frame.Equipment != nil:
+		width, height := filter.Frame.Equipment.FieldOfView()
+		along, across, positionAngle = height/2, width/2, filter.Frame.Rotation
+		ellipse = false
+	case object.MajorAxis > 0:
+		along, across, positionAngle = object.MajorAxis/2, object.MinorAxis/2, object.PositionAngle
+		if across <= 0 {
+			across = along
+		}
+	default:
+		return nil
+	}
+
+	center := spatial.Point{RA: object.Ra.toDegree(), Dec: object.Dec.toDegree()}
+	samples := make([]AstroObject, 0, extentGridSize*extentGridSize)
+	for i := 0; i < extentGridSize; i++ {
+		for j := 0; j < extentGridSize; j++ {
+			u := 2*float64(i)/(extentGridSize-1) - 1
+			v := 2*float64(j)/(extentGridSize-1) - 1
+			if ellipse && u*u+v*v > 1 {
+				continue
+			}
+			p := center
+			if u != 0 || v != 0 {
+				x, y := across*v, along*u
+				p = spatial.Destination(center, math.Hypot(x, y)/60, positionAngle+Rad2deg(math.Atan2(x, y)))
+			}
+			samples = append(samples, AstroObject{Ra: raFromDegrees(p.RA), Dec: decFromDegrees(p.Dec)})
+		}
+	}
+	return samples
+}
+
+// clearPercent returns the part of the sample points not blocked by the
+// obstructions at the given time
+func clearPercent(samples []AstroObject, position *Position, t time.Time, obstructions []Obstruction) float64 {
+	clear := 0
+	for _, sample := range samples {
+		alt, az := radecToAltAz(sample, position, t)
+		if lineOfSight(alt, az, obstructions).Status != ClearanceBlocked {
+			clear++
+		}
+	}
+	return 100 * float64(clear) / float64(len(samples))
+}
@@ -0,0 +1,114 @@
+package visibility
+
+import (
+	"math"
+	"time"
+)
+
+// siderealRate is the Earth's rotation rate in radians per second
+const siderealRate = 7.2921159e-5
+
+// FieldRotationOptions describes the camera and the imaging plan used to
+// judge field rotation on alt-az mounts.
+type FieldRotationOptions struct {
+	SensorWidthPx  int
+	SensorHeightPx int
+	// TolerancePx is the largest acceptable trail at the sensor corner
+	TolerancePx float64
+	// SubExposure is the planned sub-exposure length. Periods where the safe
+	// sub-exposure is shorter are reported as unacceptable.
+	SubExposure time.Duration
+	// Step is the sampling interval, 5 minutes when 0
+	Step time.Duration
+}
+
+type FieldRotationSample struct {
+	Time             time.Time     `json:"time"`
+	RateDegPerMinute float64       `json:"rateDegPerMinute"`
+	MaxSubExposure   time.Duration `json:"maxSubExposure"`
+}
+
+// FieldRotation summarizes field rotation over a visibility window
+type FieldRotation struct {
+	Samples             []FieldRotationSample `json:"samples"`
+	MaxRateDegPerMinute float64               `json:"maxRateDegPerMinute"`
+	MinSafeSubExposure  time.Duration         `json:"minSafeSubExposure"`
+	SubExposure         time.Duration         `json:"subExposure,omitempty"`
+	UnacceptablePeriods []TimeRange           `json:"unacceptablePeriods,omitempty"`
+}
+
+// fieldRotationRate returns the rotation rate of the field of an alt-az
+// mount in radians per second. It grows without bound towards the zenith.
+func fieldRotationRate(latitude, altitude, azimuth float64) float64 {
+	// Keep the rate finite at the zenith itself
+	cosAlt := math.Max(math.Cos(Deg2rad(altitude)), epsilon)
+	return siderealRate * math.Cos(Deg2rad(latitude)) * math.Cos(Deg2rad(azimuth)) / cosAlt
+}
+
+// maxSubExposure returns the longest exposure keeping the trail at the
+// sensor corner within the tolerance at the given rotation rate
+func (options *FieldRotationOptions) maxSubExposure(rate float64) time.Duration {
+	cornerRadius := math.Hypot(float64(options.SensorWidthPx), float64(options.SensorHeightPx)) / 2
+	if rate == 0 || cornerRadius == 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	seconds := options.TolerancePx / (cornerRadius * math.Abs(rate))
+	if seconds > math.MaxInt64/float64(time.Second) {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// AnalyzeFieldRotation computes field rotation for every visibility window
+// of alt-az mounts, at the position of the window's config. Windows of
+// equatorial mounts, which have a pier side, are left untouched.
+func AnalyzeFieldRotation(infos []VisibilityInfo, configArray *ConfigArray, options FieldRotationOptions) {
+	step := options.Step
+	if step <= 0 {
+		step = 5 * time.Minute
+	}
+	for i := range infos {
+		for j := range infos[i].VisibilityWindows {
+			window := &infos[i].VisibilityWindows[j]
+			if window.PierSide != "" {
+				continue
+			}
+			position := &configArray.windowConfig(window).Position
+			window.FieldRotation = analyzeWindowFieldRotation(infos[i].Object, window, position, &options, step)
+		}
+	}
+}
+
+func analyzeWindowFieldRotation(object AstroObject, window *VisibilityWindow, position *Position, options *FieldRotationOptions, step time.Duration) *FieldRotation {
+	rotation := &FieldRotation{
+		MinSafeSubExposure: time.Duration(math.MaxInt64),
+		SubExposure:        options.SubExposure,
+	}
+	var unacceptable *TimeRange
+	for t := window.StartTime; !t.After(window.EndTime); t = t.Add(step) {
+		alt, az := radecToAltAz(object, position, t)
+		rate := fieldRotationRate(position.Latitude, alt, az)
+		sample := FieldRotationSample{
+			Time:             t,
+			RateDegPerMinute: Rad2deg(math.Abs(rate)) * 60,
+			MaxSubExposure:   options.maxSubExposure(rate),
+		}
+		rotation.Samples = append(rotation.Samples, sample)
+		rotation.MaxRateDegPerMinute = math.Max(rotation.MaxRateDegPerMinute, sample.RateDegPerMinute)
+		rotation.MinSafeSubExposure = min(rotation.MinSafeSubExposure, sample.MaxSubExposure)
+
+		if options.SubExposure > 0 && sample.MaxSubExposure < options.SubExposure {
+			if unacceptable == nil {
+				unacceptable = &TimeRange{StartTime: t}
+			}
+			unacceptable.EndTime = t
+		} else if unacceptable != nil {
+			rotation.UnacceptablePeriods = append(rotation.UnacceptablePeriods, *unacceptable)
+			unacceptable = nil
+		}
+	}
+	if unacceptable != nil {
+		rotation.UnacceptablePeriods = append(rotation.UnacceptablePeriods, *unacceptable)
+	}
+	return rotation
+}
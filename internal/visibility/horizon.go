@@ -0,0 +1,61 @@
+package visibility
+
+// HorizonPoint is a vertex of a horizon mask: at Azimuth everything below
+// MinAltitude is blocked, and everything above MaxAltitude if it is set.
+type HorizonPoint struct {
+	Azimuth     float64  `json:"azimuth"`
+	MinAltitude float64  `json:"minAltitude"`
+	MaxAltitude *float64 `json:"maxAltitude,omitempty"`
+}
+
+// HorizonMask describes obstructions such as pillars, neighboring buildings
+// and trees as altitude limits at given azimuths. Limits between points are
+// interpolated linearly, wrapping around north, so the points may be given
+// in any order.
+type HorizonMask []HorizonPoint
+
+// Blocks reports whether the altitude lies outside of the interpolated limits
+func (mask HorizonMask) Blocks(altitude, azimuth float64) bool {
+	minAlt, maxAlt := mask.AltitudeLimits(azimuth)
+	return altitude < minAlt || altitude > maxAlt
+}
+
+// AltitudeLimits returns the interpolated minimum and maximum visible altitude
+// at the given azimuth. An empty mask does not limit the altitude.
+func (mask HorizonMask) AltitudeLimits(azimuth float64) (float64, float64) {
+	if len(mask) == 0 {
+		return -90, 90
+	}
+	az := normalize360(azimuth)
+
+	// Closest points counter-clockwise and clockwise of the azimuth
+	before, after := 0, 0
+	distBefore, distAfter := 360.0, 360.0
+	for i, p := range mask {
+		if d := normalize360(az - p.Azimuth); d < distBefore {
+			before, distBefore = i, d
+		}
+		if d := normalize360(p.Azimuth - az); d < distAfter {
+			after, distAfter = i, d
+		}
+	}
+	if distBefore == 0 {
+		return mask[before].MinAltitude, mask[before].maxAltitude()
+	}
+
+	fraction := distBefore / (distBefore + distAfter)
+	minAlt := lerp(mask[before].MinAltitude, mask[after].MinAltitude, fraction)
+	maxAlt := lerp(mask[before].maxAltitude(), mask[after].maxAltitude(), fraction)
+	return minAlt, maxAlt
+}
+
+func (p *HorizonPoint) maxAltitude() float64 {
+	if p.MaxAltitude == nil {
+		return 90
+	}
+	return *p.MaxAltitude
+}
+
+func lerp(a, b, fraction float64) float64 {
+	return a + (b-a)*fraction
+}
@@ -0,0 +1,185 @@
+package visibility
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/tps193/balcony-stargazer/internal/database"
+)
+
+// JournalEntry records one imaging session of an object. Config names the
+// setup used, e.g. the site or mount.
+type JournalEntry struct {
+	Object    string    `json:"object"`
+	StartTime time.Time `json:"startTime"`
+	Minutes   float64   `json:"minutes"`
+	Config    string    `json:"config,omitempty"`
+	Filter    string    `json:"filter,omitempty"`
+	Notes     string    `json:"notes,omitempty"`
+}
+
+// Journal is the list of past imaging sessions kept in a JSON file
+type Journal struct {
+	Entries []JournalEntry `json:"entries"`
+}
+
+// JournalSummary is the time an object was imaged in past sessions
+type JournalSummary struct {
+	Total    time.Duration `json:"total"`
+	Sessions int           `json:"sessions"`
+	Last     time.Time     `json:"last"`
+}
+
+// LoadJournal reads the journal file. A missing file is an empty journal.
+func LoadJournal(path string) (*Journal, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Journal{Entries: []JournalEntry{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var journal Journal
+	if err := json.Unmarshal(data, &journal); err != nil {
+		return nil, fmt.Errorf("journal %s: %w", path, err)
+	}
+	return &journal, nil
+}
+
+// Save writes the journal to the file. It writes a temporary file first so
+// that an interrupted save keeps the old journal.
+func (journal *Journal) Save(path string) error {
+	data, err := json.MarshalIndent(journal, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Add records a session
+func (journal *Journal) Add(entry JournalEntry) error {
+	if entry.Object == "" {
+		return errors.New("journal entry needs an object")
+	}
+	if entry.Minutes <= 0 {
+		return errors.New("journal entry needs a positive duration")
+	}
+	journal.Entries = append(journal.Entries, entry)
+	return nil
+}
+
+// Summaries adds up the sessions of every object name in the journal
+func (journal *Journal) Summaries() map[string]JournalSummary {
+	summaries := make(map[string]JournalSummary)
+	for _, entry := range journal.Entries {
+		summary := summaries[entry.Object]
+		summary.Total += time.Duration(entry.Minutes * float64(time.Minute))
+		summary.Sessions++
+		if entry.StartTime.After(summary.Last) {
+			summary.Last = entry.StartTime
+		}
+		summaries[entry.Object] = summary
+	}
+	return summaries
+}
+
+// JournalIndex holds the past sessions per object for looking up many
+// objects, built once by Journal.Index
+type JournalIndex struct {
+	summaries map[string]JournalSummary
+	// rows are the catalog objects found in the journal, used to resolve
+	// the other names of the objects looked up
+	rows []database.CatalogRow
+}
+
+// Index adds up the sessions per object. Names are compared as catalog
+// designations, so "NGC 598" and "NGC0598" are the same object. With catalog
+// rows, Messier numbers and common names are resolved to the catalog object
+// as well, both for the sessions and for the objects looked up, so a session
+// logged as "M33" counts for "Triangulum Galaxy (NGC0598)" and one logged as
+// "NGC0598" counts for "M33".
+func (journal *Journal) Index(rows []database.CatalogRow) *JournalIndex {
+	index := &JournalIndex{summaries: make(map[string]JournalSummary)}
+	for name, summary := range journal.Summaries() {
+		key := database.NormalizeDesignation(name)
+		if row, ok := database.FindObject(rows, name); ok {
+			key = database.NormalizeDesignation(row.Name)
+			if _, found := database.FindObject(index.rows, row.Name); !found {
+				index.rows = append(index.rows, *row)
+			}
+		}
+		total := index.summaries[key]
+		total.Total += summary.Total
+		total.Sessions += summary.Sessions
+		if summary.Last.After(total.Last) {
+			total.Last = summary.Last
+		}
+		index.summaries[key] = total
+	}
+	return index
+}
+
+// Summary returns the past sessions of the object, looked up by its full
+// name, its catalog name or one of its common names. Sessions recorded
+// under different names of the same object are added up.
+func (index *JournalIndex) Summary(name string) JournalSummary {
+	var total JournalSummary
+	seen := make(map[string]bool)
+	for _, name := range objectNames(name) {
+		key := database.NormalizeDesignation(name)
+		if row, ok := database.FindObject(index.rows, name); ok {
+			key = database.NormalizeDesignation(row.Name)
+		}
+		summary, ok := index.summaries[key]
+		if !ok || seen[key] {
+			continue
+		}
+		seen[key] = true
+		total.Total += summary.Total
+		total.Sessions += summary.Sessions
+		if summary.Last.After(total.Last) {
+			total.Last = summary.Last
+		}
+	}
+	return total
+}
+
+// FilterCompleted drops the objects imaged for at least goal in past
+// sessions
+func (index *JournalIndex) FilterCompleted(objects *AstroObjectArray, goal time.Duration) *AstroObjectArray {
+	filtered := &AstroObjectArray{Objects: []AstroObject{}}
+	for _, object := range objects.Objects {
+		if index.Summary(object.Name).Total >= goal {
+			logger.Debug("completed in the journal, skipping", "object", object.Name)
+			continue
+		}
+		filtered.Objects = append(filtered.Objects, object)
+	}
+	return filtered
+}
+
+// AnalyzeJournal fills in the past sessions of every object imaged before
+func AnalyzeJournal(infos []VisibilityInfo, index *JournalIndex) {
+	for i := range infos {
+		if summary := index.Summary(infos[i].Object.Name); summary.Sessions > 0 {
+			infos[i].Journal = &summary
+		}
+	}
+}
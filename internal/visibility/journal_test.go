@@ -0,0 +1,79 @@
+package visibility
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tps193/balcony-stargazer/internal/database"
+)
+
+func TestJournal(t *testing.T) {
+	path := t.TempDir() + "/journal.json"
+	journal, err := LoadJournal(path)
+	if err != nil || len(journal.Entries) != 0 {
+		t.Fatalf("expected an empty journal for a missing file, got %+v, %v", journal, err)
+	}
+	start := time.Date(2025, 9, 1, 22, 0, 0, 0, time.UTC)
+	for _, entry := range []JournalEntry{
+		{Object: "NGC0598", StartTime: start, Minutes: 120, Filter: "L"},
+		{Object: "Triangulum Galaxy", StartTime: start.AddDate(0, 0, 1), Minutes: 60},
+		{Object: "NGC0281", StartTime: start, Minutes: 600},
+	} {
+		if err := journal.Add(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := journal.Add(JournalEntry{Object: "M31"}); err == nil {
+		t.Error("expected an error for a session without a duration")
+	}
+	if err := journal.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	journal, err = LoadJournal(path)
+	if err != nil || len(journal.Entries) != 3 {
+		t.Fatalf("reloaded %+v, %v", journal, err)
+	}
+
+	// Sessions under the catalog and the common name add up
+	index := journal.Index(nil)
+	summary := index.Summary("Triangulum Galaxy (NGC0598)")
+	if summary.Total != 3*time.Hour || summary.Sessions != 2 || !summary.Last.Equal(start.AddDate(0, 0, 1)) {
+		t.Errorf("summary %+v, want 3h in 2 sessions", summary)
+	}
+
+	objects := &AstroObjectArray{Objects: []AstroObject{{Name: "Pacman Nebula (NGC0281)"}, {Name: "Triangulum Galaxy (NGC0598)"}, {Name: "M31"}}}
+	if kept := index.FilterCompleted(objects, 5*time.Hour); len(kept.Objects) != 2 || kept.Objects[0].Name != "Triangulum Galaxy (NGC0598)" {
+		t.Errorf("kept %+v, want the completed object dropped", kept.Objects)
+	}
+
+	// Messier numbers resolve through the catalog and designations are
+	// normalized
+	rows := []database.CatalogRow{{Name: "NGC0598", M: "33", Commonnames: "Triangulum Galaxy,Triangulum Pinwheel"}}
+	other := &Journal{Entries: []JournalEntry{{Object: "M33", StartTime: start, Minutes: 60}, {Object: "ngc 598", StartTime: start, Minutes: 30}}}
+	if summary := other.Index(rows).Summary("Triangulum Galaxy,Triangulum Pinwheel (NGC0598)"); summary.Total != 90*time.Minute || summary.Sessions != 2 {
+		t.Errorf("summary %+v, want 1h30m in 2 sessions", summary)
+	}
+
+	// Objects looked up by another name of a catalog object in the journal,
+	// as in observe, find its sessions
+	rows = append(rows, database.CatalogRow{Name: "NGC0224", M: "31", Commonnames: "Andromeda Galaxy"})
+	logged := (&Journal{Entries: []JournalEntry{{Object: "NGC 224", StartTime: start, Minutes: 45}}}).Index(rows)
+	for _, name := range []string{"M31", "Andromeda Galaxy", "NGC0224"} {
+		if summary := logged.Summary(name); summary.Total != 45*time.Minute || summary.Sessions != 1 {
+			t.Errorf("summary of %s %+v, want 45m in 1 session", name, summary)
+		}
+	}
+	if summary := logged.Summary("M33"); summary.Sessions != 0 {
+		t.Errorf("summary of M33 %+v, want no sessions", summary)
+	}
+
+	window := []VisibilityWindow{{StartTime: start, EndTime: start.Add(time.Hour), PeakAlt: 50, PeakTime: start}}
+	infos := []VisibilityInfo{
+		{Object: AstroObject{Name: "Triangulum Galaxy (NGC0598)"}, VisibilityWindows: window, TotalDuration: time.Hour},
+		{Object: AstroObject{Name: "M31"}, VisibilityWindows: window, TotalDuration: time.Hour},
+	}
+	RankByScore(infos, []TimeRange{{StartTime: start, EndTime: start.Add(time.Hour)}}, ScoreOptions{Weights: DefaultScoreWeights, Configs: &ConfigArray{Configs: []Config{{Position: testConfig.Position}}}, Journal: index, ExposureGoal: 6 * time.Hour})
+	if infos[0].Object.Name != "M31" || *infos[0].Score.Exposure != 1 || *infos[1].Score.Exposure != 0.5 {
+		t.Errorf("expected the object never imaged first, got %s with %+v", infos[0].Object.Name, infos[0].Score)
+	}
+}
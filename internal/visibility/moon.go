@@ -0,0 +1,88 @@
+package visibility
+
+import (
+	"math"
+	"time"
+
+	"github.com/tps193/balcony-stargazer/internal/ephemeris"
+	"github.com/tps193/balcony-stargazer/internal/spatial"
+)
+
+// MoonAvoidance is a Lorentzian moon avoidance rule as used by N.I.N.A. and
+// ACP. The required separation from the Moon is Separation degrees at full
+// moon and falls off towards new moon; Width, in days, sets how fast. The
+// rule applies while the Moon is above the horizon.
+type MoonAvoidance struct {
+	Separation float64 `json:"separation"`
+	Width      float64 `json:"width"`
+}
+
+// requiredSeparation returns the separation needed at the given moon age in
+// days
+func (avoidance *MoonAvoidance) requiredSeparation(age float64) float64 {
+	if avoidance.Width <= 0 {
+		return avoidance.Separation
+	}
+	x := (0.5 - age/ephemeris.SynodicMonth) / (avoidance.Width / ephemeris.SynodicMonth)
+	return avoidance.Separation / (1 + x*x)
+}
+
+// moonState is the Moon as seen from the site at one time step
+type moonState struct {
+	altitude, azimuth float64
+	illumination, age float64
+	separation        float64
+}
+
+func moonAt(object AstroObject, position *Position, t time.Time) moonState {
+	var state moonState
+	state.altitude, state.azimuth = ephemeris.MoonHorizontal(position.Latitude, position.Longitude, t)
+	state.illumination, state.age = ephemeris.MoonPhase(t)
+	target := spatial.Point{RA: object.Ra.toDegree(), Dec: object.Dec.toDegree()}
+	state.separation = spatial.Separation(target, ephemeris.Moon(t))
+	return state
+}
+
+// allows reports whether the avoidance rule lets the object be imaged with
+// the Moon in the given state
+func (avoidance *MoonAvoidance) allows(moon moonState) bool {
+	return moon.altitude <= 0 || moon.separation >= avoidance.requiredSeparation(moon.age)
+}
+
+// MoonInfo summarizes the Moon during a visibility window. Illumination is
+// taken at the middle of the window.
+type MoonInfo struct {
+	Illumination  float64 `json:"illumination"`
+	MinSeparation float64 `json:"minSeparation"`
+	MaxAltitude   float64 `json:"maxAltitude"`
+	// RequiredSeparation is set when a moon avoidance rule is used
+	RequiredSeparation float64 `json:"requiredSeparation,omitempty"`
+}
+
+// AnalyzeMoon fills in the Moon's illumination, its smallest separation from
+// the object and its highest altitude for every visibility window, seen from
+// the window's config
+func AnalyzeMoon(infos []VisibilityInfo, configArray *ConfigArray, avoidance *MoonAvoidance) {
+	for i := range infos {
+		for j := range infos[i].VisibilityWindows {
+			window := &infos[i].VisibilityWindows[j]
+			position := &configArray.windowConfig(window).Position
+			middle := window.StartTime.Add(window.EndTime.Sub(window.StartTime) / 2)
+			moon := moonAt(infos[i].Object, position, middle)
+			info := &MoonInfo{
+				Illumination:  moon.illumination,
+				MinSeparation: math.Inf(1),
+				MaxAltitude:   -90,
+			}
+			if avoidance != nil {
+				info.RequiredSeparation = avoidance.requiredSeparation(moon.age)
+			}
+			for t := window.StartTime; !t.After(window.EndTime); t = t.Add(5 * time.Minute) {
+				moon := moonAt(infos[i].Object, position, t)
+				info.MinSeparation = math.Min(info.MinSeparation, moon.separation)
+				info.MaxAltitude = math.Max(info.MaxAltitude, moon.altitude)
+			}
+			window.Moon = info
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package visibility
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/tps193/balcony-stargazer/internal/spatial"
+)
+
+// DefaultMosaicOverlap is the part of the frame shared by neighboring panels
+const DefaultMosaicOverlap = 0.15
+
+// MosaicPanel is one frame of a mosaic. Row 0 is at the top of the frame
+// orientation, column 0 on the left.
+type MosaicPanel struct {
+	Row               int                `json:"row"`
+	Column            int                `json:"column"`
+	Object            AstroObject        `json:"object"`
+	VisibilityWindows []VisibilityWindow `json:"visibilityWindows"`
+	TotalDuration     time.Duration      `json:"totalDuration"`
+}
+
+// Mosaic is a grid of panels covering an object larger than the frame
+type Mosaic struct {
+	Object  AstroObject   `json:"object"`
+	Framing Framing       `json:"framing"`
+	Rows    int           `json:"rows"`
+	Columns int           `json:"columns"`
+	Overlap float64       `json:"overlap"`
+	Panels  []MosaicPanel `json:"panels"`
+}
+
+// PlanMosaic covers the object with a grid of frames overlapping by the given
+// fraction and turned by the frame rotation. Every panel is a target of its
+// own centered on the panel. Objects fitting the frame get a single panel.
+func PlanMosaic(object AstroObject, options FramingOptions, overlap float64) Mosaic {
+	framing, _ := options.Frame(object)
+	mosaic := Mosaic{Object: object, Framing: framing, Overlap: overlap, Rows: 1, Columns: 1}
+
+	fovWidth, fovHeight := options.Equipment.FieldOfView()
+	stepWidth, stepHeight := fovWidth*(1-overlap), fovHeight*(1-overlap)
+	if object.MajorAxis > 0 {
+		width, height := options.extents(object)
+		mosaic.Columns = panelCount(width, fovWidth, stepWidth)
+		mosaic.Rows = panelCount(height, fovHeight, stepHeight)
+	}
+
+	center := spatial.Point{RA: object.Ra.toDegree(), Dec: object.Dec.toDegree()}
+	for row := 0; row < mosaic.Rows; row++ {
+		for column := 0; column < mosaic.Columns; column++ {
+			// Offsets in arc minutes along the frame axes, x to the east and
+			// y to the north for a north-up frame
+			x := (float64(column) - float64(mosaic.Columns-1)/2) * stepWidth
+			y := (float64(mosaic.Rows-1)/2 - float64(row)) * stepHeight
+			panelCenter := center
+			if x != 0 || y != 0 {
+				positionAngle := options.Rotation + Rad2deg(math.Atan2(x, y))
+				panelCenter = spatial.Destination(center, math.Hypot(x, y)/60, positionAngle)
+			}
+			mosaic.Panels = append(mosaic.Panels, MosaicPanel{
+				Row:    row,
+				Column: column,
+				Object: AstroObject{
+					Name:       fmt.Sprintf("%s panel %d-%d", object.Name, row+1, column+1),
+					Ra:         raFromDegrees(panelCenter.RA),
+					Dec:        decFromDegrees(panelCenter.Dec),
+					ObjectType: object.ObjectType,
+				},
+			})
+		}
+	}
+	return mosaic
+}
+
+// panelCount returns the number of frames of the given size and step needed
+// to cover the extent. Without a positive step the frames cannot be moved
+// and a single one is used.
+func panelCount(extent, frame, step float64) int {
+	if extent <= frame || step <= 0 {
+		return 1
+	}
+	return 1 + int(math.Ceil((extent-frame)/step))
+}
+
+// CapturablePanels returns the number of panels with a visibility window
+func (mosaic *Mosaic) CapturablePanels() int {
+	count := 0
+	for _, panel := range mosaic.Panels {
+		if len(panel.VisibilityWindows) > 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// CalculateMosaicVisibility runs the visibility calculation for every panel
+// of the mosaics. With printVisibleOnly mosaics without a single capturable
+// panel are left out.
+func CalculateMosaicVisibility(mosaics []Mosaic, configArray *ConfigArray, timeRanges []TimeRange, stepInMinutes time.Duration, filter Filter, printVisibleOnly bool) []Mosaic {
+	var result []Mosaic
+	for _, mosaic := range mosaics {
+		panels := &AstroObjectArray{}
+		for _, panel := range mosaic.Panels {
+			panels.Objects = append(panels.Objects, panel.Object)
+		}
+		infos := CalculateAltitudeVisibility(panels, configArray, timeRanges, stepInMinutes, filter, true)
+		for _, info := range infos {
+			for i := range mosaic.Panels {
+				if mosaic.Panels[i].Object.Name == info.Object.Name {
+					mosaic.Panels[i].VisibilityWindows = info.VisibilityWindows
+					mosaic.Panels[i].TotalDuration = info.TotalDuration
+				}
+			}
+		}
+		if printVisibleOnly && mosaic.CapturablePanels() == 0 {
+			logger.Debug("no capturable mosaic panels, skipping", "object", mosaic.Object.Name)
+			continue
+		}
+		result = append(result, mosaic)
+	}
+	return result
+}
+
+// SplitMosaics replaces the objects needing a mosaic with the given framing
+// by mosaic plans and returns the remaining objects and the mosaics. The
+// overlap must be at least 0 and less than 1.
+func SplitMosaics(objects *AstroObjectArray, options FramingOptions, overlap float64) (*AstroObjectArray, []Mosaic, error) {
+	if overlap < 0 || overlap >= 1 {
+		return nil, nil, fmt.Errorf("mosaic overlap must be at least 0 and less than 1, got %v", overlap)
+	}
+	remaining := &AstroObjectArray{Objects: []AstroObject{}}
+	var mosaics []Mosaic
+	for _, object := range objects.Objects {
+		if framing, ok := options.Frame(object); ok && framing.NeedsMosaic {
+			mosaics = append(mosaics, PlanMosaic(object, options, overlap))
+			continue
+		}
+		remaining.Objects = append(remaining.Objects, object)
+	}
+	return remaining, mosaics, nil
+}
@@ -0,0 +1,139 @@
+package visibility
+
+import (
+	"fmt"
+	"math"
+)
+
+type TrackingType string
+
+const (
+	TrackingAltAz      TrackingType = "altaz"
+	TrackingEquatorial TrackingType = "eq"
+)
+
+// PierSide is the side of the pier the tube of an equatorial mount is on.
+// Objects east of the meridian are tracked from the west side, objects west
+// of it from the east side, so crossing the meridian needs a flip.
+type PierSide string
+
+const (
+	PierSideEast PierSide = "east"
+	PierSideWest PierSide = "west"
+)
+
+// MountProfile holds the pointing limits of a mount. ZenithAvoidanceRadius
+// is the radius of the hole around the zenith an alt-az mount cannot track
+// through. For equatorial mounts HourAngleLimitEast and HourAngleLimitWest
+// limit how far east and west of the meridian, in hours, the mount can
+// point; 0 means no limit.
+type MountProfile struct {
+	Name                  string       `json:"name"`
+	MinAltitude           float64      `json:"minAltitude"`
+	MaxAltitude           float64      `json:"maxAltitude"`
+	ZenithAvoidanceRadius float64      `json:"zenithAvoidanceRadius,omitempty"`
+	Tracking              TrackingType `json:"tracking"`
+	HourAngleLimitEast    float64      `json:"hourAngleLimitEast,omitempty"`
+	HourAngleLimitWest    float64      `json:"hourAngleLimitWest,omitempty"`
+}
+
+// DefaultMountProfile is used by configs without a mount
+var DefaultMountProfile = MountProfile{
+	Name:        "default",
+	MinAltitude: minObservableAltitude,
+	MaxAltitude: maxObservableAltitude,
+	Tracking:    TrackingAltAz,
+}
+
+// BuiltinMountProfiles can be referenced by name without being declared in
+// the config. Limits are typical values; declare a profile with the same
+// name in the config to override them.
+var BuiltinMountProfiles = []MountProfile{
+	DefaultMountProfile,
+	{Name: "seestar-s50", MinAltitude: 10, MaxAltitude: 85, ZenithAvoidanceRadius: 5, Tracking: TrackingAltAz},
+	{Name: "vespera", MinAltitude: 15, MaxAltitude: 85, ZenithAvoidanceRadius: 5, Tracking: TrackingAltAz},
+	{Name: "eq", MinAltitude: 15, MaxAltitude: 90, Tracking: TrackingEquatorial},
+}
+
+// ResolveMounts links every config to its mount profile, looking the name up
+// in the profiles declared in the config array first and in the built-in
+// profiles second.
+func (configArray *ConfigArray) ResolveMounts() error {
+	for i := range configArray.Configs {
+		config := &configArray.Configs[i]
+		if config.Mount == "" {
+			continue
+		}
+		profile, ok := findMountProfile(configArray.Mounts, config.Mount)
+		if !ok {
+			profile, ok = findMountProfile(BuiltinMountProfiles, config.Mount)
+		}
+		if !ok {
+			return fmt.Errorf("unknown mount profile %q", config.Mount)
+		}
+		config.mountProfile = &profile
+	}
+	return nil
+}
+
+func findMountProfile(profiles []MountProfile, name string) (MountProfile, bool) {
+	for _, p := range profiles {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return MountProfile{}, false
+}
+
+// MountProfile returns the resolved mount profile of the config. Configs
+// without a mount use DefaultMountProfile, whose maximum altitude is lifted
+// to 90° when an overhang gives the real upper limit.
+func (config *Config) MountProfile() MountProfile {
+	if config.mountProfile != nil {
+		return *config.mountProfile
+	}
+	if config.Mount != "" {
+		if profile, ok := findMountProfile(BuiltinMountProfiles, config.Mount); ok {
+			return profile
+		}
+	}
+	profile := DefaultMountProfile
+	if config.Overhang != nil {
+		profile.MaxAltitude = 90
+	}
+	return profile
+}
+
+// altitudeRange returns the obstruction for the mount's altitude limits,
+// including the zenith hole
+func (profile *MountProfile) altitudeRange() *AltitudeRange {
+	return &AltitudeRange{
+		Min: profile.MinAltitude,
+		Max: math.Min(profile.MaxAltitude, 90-profile.ZenithAvoidanceRadius),
+	}
+}
+
+// pierSide returns the pier side an equatorial mount tracks an object at the
+// given hour angle (in degrees) from, and whether the hour angle is within
+// the mount's limits
+func (profile *MountProfile) pierSide(hourAngle float64) (PierSide, bool) {
+	hours := hourAngle / 15
+	if hours < 0 {
+		return PierSideWest, profile.HourAngleLimitEast <= 0 || -hours <= profile.HourAngleLimitEast
+	}
+	return PierSideEast, profile.HourAngleLimitWest <= 0 || hours <= profile.HourAngleLimitWest
+}
+
+// allowsPierSide reports whether the tube fits at the config on the given
+// pier side
+func (config *Config) allowsPierSide(side PierSide) bool {
+	if len(config.PierSides) == 0 {
+		return true
+	}
+	for _, s := range config.PierSides {
+		if s == side {
+			return true
+		}
+	}
+	return false
+}
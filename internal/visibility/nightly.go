@@ -0,0 +1,82 @@
+package visibility
+
+import (
+	"sort"
+	"time"
+)
+
+// NightVisibility holds the visibility windows of an object in one night.
+// PeakAlt and PeakTime are the highest point over the night's windows.
+type NightVisibility struct {
+	Night             TimeRange          `json:"night"`
+	VisibilityWindows []VisibilityWindow `json:"visibilityWindows"`
+	TotalDuration     time.Duration      `json:"totalDuration"`
+	PeakAlt           float64            `json:"peakAlt,omitempty"`
+	PeakTime          *time.Time         `json:"peakTime,omitempty"`
+}
+
+// NightlyVisibility splits the visibility of an object over a date range
+// into nights
+type NightlyVisibility struct {
+	Object        AstroObject       `json:"object"`
+	Nights        []NightVisibility `json:"nights"`
+	TotalDuration time.Duration     `json:"totalDuration"`
+	// VisibleNights counts the nights with at least one window
+	VisibleNights int `json:"visibleNights"`
+}
+
+// GroupByNight assigns the windows of every object to the time range, one
+// per night, they start in. Every time range gets an entry, also when the
+// object is not visible in it.
+func GroupByNight(infos []VisibilityInfo, timeRanges []TimeRange) []NightlyVisibility {
+	nightly := make([]NightlyVisibility, 0, len(infos))
+	for _, info := range infos {
+		plan := NightlyVisibility{Object: info.Object, Nights: make([]NightVisibility, len(timeRanges))}
+		for i, timeRange := range timeRanges {
+			plan.Nights[i] = NightVisibility{Night: timeRange, VisibilityWindows: []VisibilityWindow{}}
+		}
+		for _, window := range info.VisibilityWindows {
+			i := sort.Search(len(timeRanges), func(i int) bool {
+				return timeRanges[i].EndTime.After(window.StartTime) || timeRanges[i].EndTime.Equal(window.StartTime)
+			})
+			if i == len(timeRanges) {
+				continue
+			}
+			night := &plan.Nights[i]
+			night.VisibilityWindows = append(night.VisibilityWindows, window)
+			if night.PeakTime == nil || window.PeakAlt > night.PeakAlt {
+				peakTime := window.PeakTime
+				night.PeakAlt = window.PeakAlt
+				night.PeakTime = &peakTime
+			}
+		}
+		for i := range plan.Nights {
+			night := &plan.Nights[i]
+			night.TotalDuration = calculateTotalVisibility(night.VisibilityWindows)
+			plan.TotalDuration += night.TotalDuration
+			if len(night.VisibilityWindows) > 0 {
+				plan.VisibleNights++
+			}
+		}
+		nightly = append(nightly, plan)
+	}
+	return nightly
+}
+
+// HighestNights returns up to count nights in which the object is visible,
+// highest peak first
+func (plan *NightlyVisibility) HighestNights(count int) []NightVisibility {
+	var nights []NightVisibility
+	for _, night := range plan.Nights {
+		if len(night.VisibilityWindows) > 0 {
+			nights = append(nights, night)
+		}
+	}
+	sort.SliceStable(nights, func(i, j int) bool {
+		return nights[i].PeakAlt > nights[j].PeakAlt
+	})
+	if count > 0 && len(nights) > count {
+		nights = nights[:count]
+	}
+	return nights
+}
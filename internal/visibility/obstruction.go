@@ -0,0 +1,170 @@
+package visibility
+
+import "math"
+
+// Obstruction is anything that hides part of the sky from the telescope.
+// Implementations must be cheap and must not allocate: Blocks is called for
+// every object, config and time step.
+type Obstruction interface {
+	// Blocks reports whether the given altitude and azimuth are hidden
+	Blocks(altitude, azimuth float64) bool
+	// AltitudeLimits returns the visible altitude range at the azimuth. A
+	// range with min > max means the whole azimuth is blocked.
+	AltitudeLimits(azimuth float64) (float64, float64)
+}
+
+// AzimuthWindow blocks everything outside of the clockwise arc from Left to
+// Right. The arc must be shorter than 180°.
+type AzimuthWindow struct {
+	Left  float64
+	Right float64
+}
+
+// Blocks reports whether the azimuth lies outside of the arc
+func (w *AzimuthWindow) Blocks(altitude, azimuth float64) bool {
+	return !(isClockwise(w.Left, azimuth) && isClockwise(azimuth, w.Right))
+}
+
+// AltitudeLimits returns the full altitude range inside the arc and an empty
+// range outside of it
+func (w *AzimuthWindow) AltitudeLimits(azimuth float64) (float64, float64) {
+	if w.Blocks(0, azimuth) {
+		return 90, -90
+	}
+	return -90, 90
+}
+
+// AltitudeRange blocks everything below Min and above Max at any azimuth.
+type AltitudeRange struct {
+	Min float64
+	Max float64
+}
+
+// Blocks reports whether the altitude lies outside of [Min, Max]
+func (r *AltitudeRange) Blocks(altitude, azimuth float64) bool {
+	return altitude < r.Min || altitude > r.Max
+}
+
+// AltitudeLimits returns Min and Max regardless of the azimuth
+func (r *AltitudeRange) AltitudeLimits(azimuth float64) (float64, float64) {
+	return r.Min, r.Max
+}
+
+// Fence is a straight fence perpendicular to DirectAzimuth at Distance from
+// the telescope pivot, with a window of WindowHeight above it. Everything
+// below the fence top and above the window top is blocked. With a telescope
+// geometry the edges are checked against the objective rather than the pivot
+// and may vignette part of the aperture.
+type Fence struct {
+	Height          float64
+	WindowHeight    float64
+	Distance        float64
+	TelescopeHeight float64
+	DirectAzimuth   float64
+	Telescope       TelescopeGeometry
+}
+
+// Blocks reports whether the center of the aperture is hidden
+func (f *Fence) Blocks(altitude, azimuth float64) bool {
+	if f.Telescope == (TelescopeGeometry{}) {
+		alphaMin, alphaMax := f.AltitudeLimits(azimuth)
+		return altitude < alphaMin || altitude > alphaMax
+	}
+	lower, upper := f.edgeOffsets(altitude, azimuth)
+	return lower < 0 || upper < 0
+}
+
+// BlockedFraction returns the part of the aperture covered by the fence and
+// the window top. Without an aperture diameter it is all or nothing.
+func (f *Fence) BlockedFraction(altitude, azimuth float64) float64 {
+	if f.Telescope.ApertureDiameter <= 0 {
+		if f.Blocks(altitude, azimuth) {
+			return 1
+		}
+		return 0
+	}
+	lower, upper := f.edgeOffsets(altitude, azimuth)
+	radius := f.Telescope.ApertureDiameter / 2
+	return math.Min(1, segmentFraction(lower, radius)+segmentFraction(upper, radius))
+}
+
+// edgeOffsets returns the distances, perpendicular to the optical axis, from
+// the axis down to the fence top and up to the window top. Negative values
+// mean the axis itself is blocked by that edge.
+func (f *Fence) edgeOffsets(altitude, azimuth float64) (float64, float64) {
+	alongFence := math.Cos(Deg2rad(azimuth - f.DirectAzimuth))
+	if alongFence <= epsilon {
+		// Looking away from the fence into the balcony
+		return math.Inf(-1), math.Inf(-1)
+	}
+	altRad := Deg2rad(altitude)
+	axisHeight := f.TelescopeHeight + f.Distance/alongFence*math.Tan(altRad)
+	// The optical axis runs PivotOffset above the pivot, measured
+	// perpendicular to the axis, so it shifts both edge offsets
+	lower := (axisHeight-f.Height)*math.Cos(altRad) + f.Telescope.PivotOffset
+	upper := (f.Height+f.WindowHeight-axisHeight)*math.Cos(altRad) - f.Telescope.PivotOffset
+	return lower, upper
+}
+
+// AltitudeLimits returns the altitudes of the fence top and the window top
+// seen from the pivot at the given azimuth
+func (f *Fence) AltitudeLimits(azimuth float64) (float64, float64) {
+	angleDiff := Deg2rad(math.Abs(azimuth - f.DirectAzimuth))
+	alphaMin := altitudeAtAzimuthDiff(f.Height-f.TelescopeHeight, f.Distance, angleDiff)
+	alphaMax := altitudeAtAzimuthDiff(f.WindowHeight+f.Height-f.TelescopeHeight, f.Distance, angleDiff)
+	return Rad2deg(alphaMin), Rad2deg(alphaMax)
+}
+
+func altitudeAtAzimuthDiff(actualFenceHeight, distanceToFence, angleDiff float64) float64 {
+	if actualFenceHeight <= 0 {
+		actualFenceHeight = epsilon // Avoid division by zero
+	}
+	return math.Atan(actualFenceHeight * math.Cos(angleDiff) / distanceToFence)
+}
+
+// Obstructions returns every obstruction of the config: the azimuth limits,
+// the mount's altitude range, the fence, the overhang, the horizon mask,
+// the 3D scene and any custom obstructions, in this order.
+func (config *Config) Obstructions() []Obstruction {
+	var obstructions []Obstruction
+	if config.hasAzimuthLimits() {
+		obstructions = append(obstructions, &AzimuthWindow{Left: config.LeftAzimuthLimit, Right: config.RightAzimuthLimit})
+	}
+	mount := config.MountProfile()
+	obstructions = append(obstructions, mount.altitudeRange())
+	if config.hasFence() {
+		obstructions = append(obstructions, &Fence{
+			Height:          config.FenceHeight,
+			WindowHeight:    config.WindowHeight,
+			Distance:        config.DistanceToFence,
+			TelescopeHeight: config.TelescopeHeight,
+			DirectAzimuth:   config.DirectAzimuth,
+			Telescope:       config.telescopeGeometry(),
+		})
+	}
+	if config.Overhang != nil {
+		overhang := *config.Overhang
+		overhang.telescopeHeight = config.TelescopeHeight
+		overhang.directAzimuth = config.DirectAzimuth
+		obstructions = append(obstructions, &overhang)
+	}
+	if len(config.HorizonMask) > 0 {
+		obstructions = append(obstructions, config.HorizonMask)
+	}
+	if config.Scene != nil {
+		obstructions = append(obstructions, config.Scene)
+	}
+	return append(obstructions, config.CustomObstructions...)
+}
+
+// visibleAltitudeRange intersects the altitude limits of all obstructions at
+// the given azimuth
+func visibleAltitudeRange(obstructions []Obstruction, azimuth float64) (float64, float64) {
+	alphaMin, alphaMax := -90.0, 90.0
+	for _, o := range obstructions {
+		oMin, oMax := o.AltitudeLimits(azimuth)
+		alphaMin = math.Max(alphaMin, oMin)
+		alphaMax = math.Min(alphaMax, oMax)
+	}
+	return alphaMin, alphaMax
+}
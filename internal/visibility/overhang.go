@@ -0,0 +1,52 @@
+package visibility
+
+import "math"
+
+// Overhang is the slab above the balcony, e.g. the ceiling or the balcony of
+// the upper floor. Its outer edge runs perpendicular to the config's
+// DirectAzimuth at Depth in front of the telescope, and it extends
+// LeftExtent and RightExtent to the sides of the telescope along that edge
+// (0 means the slab runs along the whole facade). The telescope is assumed
+// to stand under the slab.
+type Overhang struct {
+	Height      float64 `json:"height"`
+	Depth       float64 `json:"depth"`
+	LeftExtent  float64 `json:"leftExtent,omitempty"`
+	RightExtent float64 `json:"rightExtent,omitempty"`
+
+	telescopeHeight float64
+	directAzimuth   float64
+}
+
+// Blocks reports whether the slab hides the altitude at the given azimuth
+func (o *Overhang) Blocks(altitude, azimuth float64) bool {
+	_, maxAlt := o.AltitudeLimits(azimuth)
+	return altitude > maxAlt
+}
+
+// AltitudeLimits returns the highest altitude visible under the slab edge at
+// the given azimuth; the slab does not limit the minimum altitude.
+func (o *Overhang) AltitudeLimits(azimuth float64) (float64, float64) {
+	clearance := o.Height - o.telescopeHeight
+	if clearance <= 0 || o.Depth <= 0 {
+		return -90, 90
+	}
+	diff := Deg2rad(azimuth - o.directAzimuth)
+	along, lateral := math.Cos(diff), math.Sin(diff)
+
+	// Horizontal distance at which the line of sight leaves the slab
+	exit := math.Inf(1)
+	if along > epsilon {
+		exit = o.Depth / along
+	}
+	if lateral > epsilon && o.RightExtent > 0 {
+		exit = math.Min(exit, o.RightExtent/lateral)
+	}
+	if lateral < -epsilon && o.LeftExtent > 0 {
+		exit = math.Min(exit, o.LeftExtent/-lateral)
+	}
+	if math.IsInf(exit, 1) {
+		return -90, 0
+	}
+	return -90, Rad2deg(math.Atan(clearance / exit))
+}
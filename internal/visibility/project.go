@@ -0,0 +1,212 @@
+package visibility
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ProjectFilter is the integration goal of one filter of a project. Goal and
+// Collected are in hours.
+type ProjectFilter struct {
+	Name      string  `json:"name"`
+	Goal      float64 `json:"goal"`
+	Collected float64 `json:"collected,omitempty"`
+}
+
+// Project collects integration time on one target over many nights. Goal
+// and Collected are in hours; with Filters they are the sums over the
+// filters.
+type Project struct {
+	Name      string          `json:"name"`
+	Target    AstroObject     `json:"target"`
+	Goal      float64         `json:"goal,omitempty"`
+	Collected float64         `json:"collected,omitempty"`
+	Filters   []ProjectFilter `json:"filters,omitempty"`
+	// Priority is used when projects compete for the same time, from 0 to
+	// 10
+	Priority float64 `json:"priority,omitempty"`
+}
+
+type ProjectArray struct {
+	Projects []Project `json:"projects"`
+}
+
+// Validate checks that every project has a name and a goal, either overall
+// or per filter, no negative collected time and a priority from 0 to 10
+func (projects *ProjectArray) Validate() error {
+	names := make(map[string]bool, len(projects.Projects))
+	for _, project := range projects.Projects {
+		if project.Name == "" {
+			return errors.New("project without a name")
+		}
+		if names[project.Name] {
+			return fmt.Errorf("duplicate project %q", project.Name)
+		}
+		names[project.Name] = true
+		if project.Goal <= 0 && len(project.Filters) == 0 {
+			return fmt.Errorf("project %q needs a goal or filters with goals", project.Name)
+		}
+		if project.Collected < 0 {
+			return fmt.Errorf("project %q: collected time must not be negative", project.Name)
+		}
+		if project.Priority < 0 || project.Priority > maxPriority {
+			return fmt.Errorf("project %q: priority must be from 0 to %d", project.Name, maxPriority)
+		}
+		for _, filter := range project.Filters {
+			if filter.Goal <= 0 {
+				return fmt.Errorf("project %q: filter %q needs a goal", project.Name, filter.Name)
+			}
+			if filter.Collected < 0 {
+				return fmt.Errorf("project %q: filter %q: collected time must not be negative", project.Name, filter.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func hours(h float64) time.Duration {
+	return time.Duration(h * float64(time.Hour))
+}
+
+// totals returns the goal and the collected time over all filters
+func (project *Project) totals() (goal, collected time.Duration) {
+	if len(project.Filters) == 0 {
+		return hours(project.Goal), hours(project.Collected)
+	}
+	for _, filter := range project.Filters {
+		goal += hours(filter.Goal)
+		collected += hours(filter.Collected)
+	}
+	return goal, collected
+}
+
+// remaining returns the time still needed per filter, a single entry with
+// an empty name for projects without filters
+func (project *Project) remaining() []filterTime {
+	if len(project.Filters) == 0 {
+		return []filterTime{{remaining: max(hours(project.Goal-project.Collected), 0)}}
+	}
+	remaining := make([]filterTime, len(project.Filters))
+	for i, filter := range project.Filters {
+		remaining[i] = filterTime{name: filter.Name, remaining: max(hours(filter.Goal-filter.Collected), 0)}
+	}
+	return remaining
+}
+
+type filterTime struct {
+	name      string
+	remaining time.Duration
+}
+
+// Allocation is planned imaging time of a project in one filter
+type Allocation struct {
+	Filter    string    `json:"filter,omitempty"`
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+}
+
+// ProjectForecast is the plan for a project over the planned nights.
+// CompletionTime is nil when the goal is not reached by the last night.
+type ProjectForecast struct {
+	Project        Project       `json:"project"`
+	Remaining      time.Duration `json:"remaining"`
+	Allocations    []Allocation  `json:"allocations"`
+	Planned        time.Duration `json:"planned"`
+	Nights         int           `json:"nights"`
+	CompletionTime *time.Time    `json:"completionTime,omitempty"`
+}
+
+// ForecastProjects allocates the visibility windows of the nights to the
+// projects until their goals are met. Every night is scheduled like
+// ScheduleNight with the unfinished projects as targets; when a project
+// completes during a block, the rest of the night is scheduled again
+// without it.
+func ForecastProjects(projects []Project, configArray *ConfigArray, timeRanges []TimeRange, filter Filter, options ScheduleOptions) []ProjectForecast {
+	objects := &AstroObjectArray{Objects: make([]AstroObject, len(projects))}
+	options.Priorities = make(map[string]float64, len(projects))
+	for i, project := range projects {
+		// Targets are named after the project so that two projects on the
+		// same object stay apart
+		objects.Objects[i] = project.Target
+		objects.Objects[i].Name = project.Name
+		options.Priorities[project.Name] = project.Priority
+	}
+	infos := CalculateAltitudeVisibility(objects, configArray, timeRanges, 5, filter, false)
+
+	forecasts := make([]ProjectForecast, len(projects))
+	remaining := make([][]filterTime, len(projects))
+	byName := make(map[string]int, len(projects))
+	for i, project := range projects {
+		forecasts[i] = ProjectForecast{Project: project, Allocations: []Allocation{}}
+		remaining[i] = project.remaining()
+		byName[project.Name] = i
+	}
+	left := func(i int) time.Duration {
+		var total time.Duration
+		for _, filter := range remaining[i] {
+			total += filter.remaining
+		}
+		return total
+	}
+
+	for _, night := range timeRanges {
+		used := make(map[int]bool)
+		for start := night.StartTime; start.Before(night.EndTime); {
+			var active []VisibilityInfo
+			for i, info := range infos {
+				if left(i) > 0 {
+					active = append(active, info)
+				}
+			}
+			if len(active) == 0 {
+				break
+			}
+			schedule := ScheduleNight(active, TimeRange{StartTime: start, EndTime: night.EndTime}, options)
+			start = night.EndTime
+			for _, block := range schedule.Blocks {
+				i := byName[block.Object.Name]
+				used[i] = true
+				end := forecasts[i].allocate(remaining[i], block.StartTime, block.EndTime)
+				if left(i) == 0 {
+					completion := end
+					forecasts[i].CompletionTime = &completion
+					if end.Before(block.EndTime) {
+						// Schedule the rest of the night without the project
+						start = end
+						break
+					}
+				}
+			}
+		}
+		for i := range used {
+			forecasts[i].Nights++
+		}
+	}
+	for i := range forecasts {
+		forecasts[i].Remaining = left(i)
+	}
+	return forecasts
+}
+
+// allocate spends the block on the filters with the most time left and
+// returns when the allocated time ends
+func (forecast *ProjectForecast) allocate(remaining []filterTime, start, end time.Time) time.Time {
+	for start.Before(end) {
+		next := 0
+		for i := range remaining {
+			if remaining[i].remaining > remaining[next].remaining {
+				next = i
+			}
+		}
+		if remaining[next].remaining <= 0 {
+			break
+		}
+		chunk := min(end.Sub(start), remaining[next].remaining)
+		forecast.Allocations = append(forecast.Allocations, Allocation{Filter: remaining[next].name, StartTime: start, EndTime: start.Add(chunk)})
+		forecast.Planned += chunk
+		remaining[next].remaining -= chunk
+		start = start.Add(chunk)
+	}
+	return start
+}
@@ -0,0 +1,67 @@
+package visibility
+
+import (
+	"testing"
+	"time"
+)
+
+func TestForecastProjects(t *testing.T) {
+	configs := &ConfigArray{Configs: []Config{{Position: testConfig.Position}}}
+	var timeRanges []TimeRange
+	for day := 20; day < 23; day++ {
+		start := time.Date(2025, 10, day, 2, 0, 0, 0, time.UTC)
+		timeRanges = append(timeRanges, TimeRange{StartTime: start, EndTime: start.Add(4 * time.Hour)})
+	}
+	projects := []Project{
+		{Name: "short", Target: m31, Goal: 1, Priority: 5},
+		{Name: "long", Target: m31, Filters: []ProjectFilter{{Name: "Ha", Goal: 3, Collected: 1}, {Name: "OIII", Goal: 2}}},
+		{Name: "endless", Target: m31, Goal: 100},
+		{Name: "done", Target: m31, Goal: 2, Collected: 3},
+	}
+	options := ScheduleOptions{MinBlock: 30 * time.Minute, Overhead: 5 * time.Minute}
+
+	forecasts := ForecastProjects(projects, configs, timeRanges, Filter{}, options)
+	short, long, endless, done := forecasts[0], forecasts[1], forecasts[2], forecasts[3]
+	if short.CompletionTime == nil || short.Nights != 1 || len(short.Allocations) != 1 {
+		t.Fatalf("short project %+v, want it complete in the first night", short)
+	}
+	first := short.Allocations[0]
+	if !short.CompletionTime.Equal(first.StartTime.Add(time.Hour)) {
+		t.Errorf("short project completes at %s, want an hour after %s", short.CompletionTime, first.StartTime)
+	}
+	// The rest of the night goes to the next project after a slew
+	if len(long.Allocations) == 0 || !long.Allocations[0].StartTime.Equal(short.CompletionTime.Add(5*time.Minute)) {
+		t.Errorf("long project starts %+v, want 5 minutes after the short one completes", long.Allocations)
+	}
+	if long.CompletionTime == nil || long.Remaining != 0 || long.Planned != 4*time.Hour {
+		t.Errorf("long project %+v, want 4h planned to completion", long)
+	}
+	if endless.CompletionTime != nil || endless.Remaining <= 0 || endless.Remaining+endless.Planned != 100*time.Hour {
+		t.Errorf("endless project %+v", endless)
+	}
+	if done.Planned != 0 || done.Remaining != 0 {
+		t.Errorf("done project %+v, want nothing planned", done)
+	}
+
+	for _, invalid := range []Project{
+		{Name: "no goal", Target: m31},
+		{Name: "negative collected", Target: m31, Goal: 1, Collected: -1},
+		{Name: "negative filter collected", Target: m31, Filters: []ProjectFilter{{Name: "Ha", Goal: 1, Collected: -1}}},
+		{Name: "negative priority", Target: m31, Goal: 1, Priority: -1},
+		{Name: "priority too high", Target: m31, Goal: 1, Priority: 11},
+	} {
+		if err := (&ProjectArray{Projects: []Project{invalid}}).Validate(); err == nil {
+			t.Errorf("expected an error for project %q", invalid.Name)
+		}
+	}
+	if err := (&ProjectArray{Projects: projects}).Validate(); err != nil {
+		t.Errorf("unexpected error for valid projects: %v", err)
+	}
+
+	// A negative overhead is planned as none instead of looping
+	options.Overhead = -time.Hour
+	forecasts = ForecastProjects(projects[:1], configs, timeRanges, Filter{}, options)
+	if forecasts[0].CompletionTime == nil || !forecasts[0].Allocations[0].StartTime.Equal(first.StartTime.Add(-5*time.Minute)) {
+		t.Errorf("short project %+v, want it to start without a slew", forecasts[0])
+	}
+}
@@ -3,6 +3,7 @@ package visibility
 import (
 	"encoding/json"
 	"fmt"
+	"time"
 )
 
 type Result interface {
@@ -19,15 +20,178 @@ func (output *ConsoleOutput) Get(visibilityWindows *[]VisibilityInfo) string {
 	res := make([]byte, 0)
 	for _, info := range *visibilityWindows {
 		res = fmt.Appendf(res, "Visibility of %s (%s):\n", info.Object.Name, info.Object.ObjectType)
-		for i, window := range info.VisibilityWindows {
-			res = fmt.Appendf(res, "%d: %s\n", i, window.EndTime.Sub(window.StartTime))
-			res = fmt.Appendf(res, "\tStart: %s (%f°)\n", window.StartTime, window.StartAlt)
-			res = fmt.Appendf(res, "\tEnd: %s (%f°)\n", window.EndTime, window.EndAlt)
+		if framing := info.Framing; framing != nil {
+			if framing.NeedsMosaic {
+				res = fmt.Appendf(res, "Framing (%s): fills %.0f%% of the frame, needs a mosaic\n", framing.Equipment, framing.FillRatio*100)
+			} else {
+				res = fmt.Appendf(res, "Framing (%s): fills %.0f%% of the frame\n", framing.Equipment, framing.FillRatio*100)
+			}
+		}
+		if score := info.Score; score != nil {
+			res = appendScore(res, score)
+		}
+		if journal := info.Journal; journal != nil {
+			res = fmt.Appendf(res, "Imaged: %s in %d sessions, last on %s\n", journal.Total, journal.Sessions, journal.Last.Format(time.DateOnly))
+		}
+		res = appendWindows(res, info.VisibilityWindows)
+	}
+	return string(res)
+}
+
+// GetMosaics lists the panels of every mosaic with their visibility windows
+func (output *ConsoleOutput) GetMosaics(mosaics []Mosaic) string {
+	res := make([]byte, 0)
+	for _, mosaic := range mosaics {
+		res = fmt.Appendf(res, "Mosaic of %s (%s): %dx%d panels, %d of %d capturable\n", mosaic.Object.Name, mosaic.Framing.Equipment, mosaic.Columns, mosaic.Rows, mosaic.CapturablePanels(), len(mosaic.Panels))
+		for _, panel := range mosaic.Panels {
+			if len(panel.VisibilityWindows) == 0 {
+				res = fmt.Appendf(res, "Panel %d-%d: not capturable\n", panel.Row+1, panel.Column+1)
+				continue
+			}
+			res = fmt.Appendf(res, "Panel %d-%d: %s\n", panel.Row+1, panel.Column+1, panel.TotalDuration)
+			res = appendWindows(res, panel.VisibilityWindows)
+		}
+	}
+	return string(res)
+}
+
+// GetNightly lists the nights of every object with their visible time and
+// peak. With best above 0 only that many nights, highest peak first, are
+// listed.
+func (output *ConsoleOutput) GetNightly(nightly []NightlyVisibility, best int) string {
+	res := make([]byte, 0)
+	for _, plan := range nightly {
+		res = fmt.Appendf(res, "Visibility of %s (%s) over %d nights: %s on %d nights\n", plan.Object.Name, plan.Object.ObjectType, len(plan.Nights), plan.TotalDuration, plan.VisibleNights)
+		nights := plan.Nights
+		if best > 0 {
+			nights = plan.HighestNights(best)
+		}
+		for _, night := range nights {
+			date := nightDate(night.Night.StartTime).Format(time.DateOnly)
+			if night.PeakTime == nil {
+				res = fmt.Appendf(res, "%s: not visible\n", date)
+				continue
+			}
+			res = fmt.Appendf(res, "%s: %s, peak %.1f° at %s\n", date, night.TotalDuration, night.PeakAlt, night.PeakTime.Format("15:04"))
+		}
+	}
+	return string(res)
+}
+
+// GetSchedules prints the timeline of every night with the slews, the
+// imaging blocks and the unused gaps
+func (output *ConsoleOutput) GetSchedules(schedules []Schedule) string {
+	res := make([]byte, 0)
+	for _, schedule := range schedules {
+		res = fmt.Appendf(res, "Schedule %s - %s: %s imaging, %s overhead, %s unused\n", schedule.Night.StartTime.Format("2006-01-02 15:04"), schedule.Night.EndTime.Format("2006-01-02 15:04"), schedule.ImagingTime, schedule.OverheadTime, schedule.UnusedTime)
+		gaps := schedule.Gaps
+		for _, block := range schedule.Blocks {
+			for len(gaps) > 0 && !gaps[0].StartTime.After(block.StartTime) {
+				res = fmt.Appendf(res, "\t%s - %s unused\n", gaps[0].StartTime.Format("15:04"), gaps[0].EndTime.Format("15:04"))
+				gaps = gaps[1:]
+			}
+			if block.Overhead > 0 {
+				res = fmt.Appendf(res, "\t%s - %s slew and frame\n", block.StartTime.Add(-block.Overhead).Format("15:04"), block.StartTime.Format("15:04"))
+			}
+			res = fmt.Appendf(res, "\t%s - %s %s, %s\n", block.StartTime.Format("15:04"), block.EndTime.Format("15:04"), block.Object.Name, block.EndTime.Sub(block.StartTime))
+		}
+		for _, gap := range gaps {
+			res = fmt.Appendf(res, "\t%s - %s unused\n", gap.StartTime.Format("15:04"), gap.EndTime.Format("15:04"))
 		}
 	}
 	return string(res)
 }
 
+// GetForecasts prints the progress and the forecast completion of every
+// project, with plan also the allocated time per night and filter
+func (output *ConsoleOutput) GetForecasts(forecasts []ProjectForecast, plan bool) string {
+	res := make([]byte, 0)
+	for _, forecast := range forecasts {
+		project := forecast.Project
+		goal, collected := project.totals()
+		res = fmt.Appendf(res, "Project %s (%s): %s of %s collected\n", project.Name, project.Target.Name, collected, goal)
+		for _, filter := range project.Filters {
+			res = fmt.Appendf(res, "\t%s: %s of %s\n", filter.Name, hours(filter.Collected), hours(filter.Goal))
+		}
+		switch {
+		case forecast.CompletionTime != nil:
+			res = fmt.Appendf(res, "\tForecast: complete on %s after %d nights\n", forecast.CompletionTime.Format("2006-01-02 15:04"), forecast.Nights)
+		case forecast.Planned == 0 && forecast.Remaining == 0:
+			res = fmt.Appendf(res, "\tComplete\n")
+		default:
+			res = fmt.Appendf(res, "\tForecast: not complete, %s planned on %d nights, %s still missing\n", forecast.Planned, forecast.Nights, forecast.Remaining)
+		}
+		if !plan {
+			continue
+		}
+		for _, allocation := range forecast.Allocations {
+			res = fmt.Appendf(res, "\t%s - %s", allocation.StartTime.Format("2006-01-02 15:04"), allocation.EndTime.Format("15:04"))
+			if allocation.Filter != "" {
+				res = fmt.Appendf(res, " %s", allocation.Filter)
+			}
+			res = fmt.Appendf(res, ", %s\n", allocation.EndTime.Sub(allocation.StartTime))
+		}
+	}
+	return string(res)
+}
+
+func appendScore(res []byte, score *Score) []byte {
+	res = fmt.Appendf(res, "Score: %.1f (duration %.2f, altitude %.2f, moon %.2f", score.Total, score.Duration, score.Altitude, score.MoonSeparation)
+	if score.Fill != nil {
+		res = fmt.Appendf(res, ", fill %.2f", *score.Fill)
+	}
+	if score.SurfaceBrightness != nil {
+		res = fmt.Appendf(res, ", surface brightness %.2f", *score.SurfaceBrightness)
+	}
+	if score.Priority != nil {
+		res = fmt.Appendf(res, ", priority %.2f", *score.Priority)
+	}
+	if score.Exposure != nil {
+		res = fmt.Appendf(res, ", exposure %.2f", *score.Exposure)
+	}
+	return fmt.Appendf(res, ")\n")
+}
+
+func appendWindows(res []byte, windows []VisibilityWindow) []byte {
+	for i, window := range windows {
+		res = fmt.Appendf(res, "%d: %s\n", i, window.EndTime.Sub(window.StartTime))
+		res = fmt.Appendf(res, "\tStart: %s (%f°)\n", window.StartTime, window.StartAlt)
+		res = fmt.Appendf(res, "\tEnd: %s (%f°)\n", window.EndTime, window.EndAlt)
+		res = fmt.Appendf(res, "\tPeak: %s (%f°), airmass %.2f to %.2f\n", window.PeakTime, window.PeakAlt, window.MinAirmass, window.MaxAirmass)
+		res = fmt.Appendf(res, "\tAzimuth: %.1f° to %.1f°\n", window.MinAz, window.MaxAz)
+		if extinction := window.Extinction; extinction != nil {
+			res = fmt.Appendf(res, "\tExtinction (%s): %.2f mag at the peak, up to %.2f mag\n", extinction.Band, extinction.AtPeak, extinction.Max)
+		}
+		if window.PierSide != "" {
+			res = fmt.Appendf(res, "\tPier side: %s\n", window.PierSide)
+		}
+		if window.FlipTime != nil {
+			res = fmt.Appendf(res, "\tMeridian flip: %s\n", *window.FlipTime)
+		}
+		if rotation := window.FieldRotation; rotation != nil {
+			res = fmt.Appendf(res, "\tField rotation: up to %.3f°/min, max safe sub-exposure %s\n", rotation.MaxRateDegPerMinute, rotation.MinSafeSubExposure.Round(time.Second))
+			for _, period := range rotation.UnacceptablePeriods {
+				res = fmt.Appendf(res, "\tToo much rotation for %s subs: %s - %s\n", rotation.SubExposure, period.StartTime, period.EndTime)
+			}
+		}
+		res = fmt.Appendf(res, "\tClearance: %s\n", window.Clearance)
+		if moon := window.Moon; moon != nil {
+			res = fmt.Appendf(res, "\tMoon: %.0f%% illuminated, up to %.1f° altitude, at least %.1f° away", moon.Illumination*100, moon.MaxAltitude, moon.MinSeparation)
+			if moon.RequiredSeparation > 0 {
+				res = fmt.Appendf(res, " (%.1f° required)", moon.RequiredSeparation)
+			}
+			res = fmt.Appendf(res, "\n")
+		}
+		if sky := window.Sky; sky != nil {
+			res = fmt.Appendf(res, "\tSky: %.1f to %.1f mag/arcsec², naked-eye limit %.1f\n", sky.Brightest, sky.Darkest, limitingMagnitude(sky.Darkest))
+		}
+		if window.MinClearPercent > 0 {
+			res = fmt.Appendf(res, "\tClear: at least %.0f%%\n", window.MinClearPercent)
+		}
+	}
+	return res
+}
+
 type JsonOutput struct {
 	VisibilityInfos []VisibilityInfo `json:"windows"`
 }
@@ -0,0 +1,139 @@
+package visibility
+
+import "math"
+
+// sceneScanStep is the altitude resolution, in degrees, of Scene.AltitudeLimits
+const sceneScanStep = 0.25
+
+// Point2 is a point on the balcony floor plan in local coordinates.
+type Point2 struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Point3 is a point in local coordinates: X and Y on the floor plan, Z up
+// from the floor. Lengths use the same unit as the rest of the config.
+type Point3 struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	Z float64 `json:"z"`
+}
+
+// Wall is a vertical rectangle standing on the segment From-To between
+// Bottom and Top, e.g. a side wall, a railing or a privacy screen.
+type Wall struct {
+	From   Point2  `json:"from"`
+	To     Point2  `json:"to"`
+	Bottom float64 `json:"bottom"`
+	Top    float64 `json:"top"`
+}
+
+// Slab is a horizontal polygon at Height, e.g. the ceiling of the balcony or
+// the balcony above. Openings are holes in the slab.
+type Slab struct {
+	Height   float64    `json:"height"`
+	Outline  []Point2   `json:"outline"`
+	Openings [][]Point2 `json:"openings,omitempty"`
+}
+
+// Scene is a 3D description of the balcony. Local +Y points to the azimuth
+// given by Orientation and +X is 90° clockwise of it. Visibility is decided
+// by casting a ray from the telescope towards the given altitude and azimuth.
+type Scene struct {
+	Orientation float64 `json:"orientation"`
+	Telescope   Point3  `json:"telescope"`
+	Walls       []Wall  `json:"walls,omitempty"`
+	Slabs       []Slab  `json:"slabs,omitempty"`
+}
+
+// Blocks casts a ray from the telescope and reports whether it hits a wall or
+// a slab
+func (scene *Scene) Blocks(altitude, azimuth float64) bool {
+	if altitude <= 0 {
+		return true // the floor, and the horizon beyond it
+	}
+	altRad := Deg2rad(altitude)
+	azRad := Deg2rad(azimuth - scene.Orientation)
+	dx := math.Cos(altRad) * math.Sin(azRad)
+	dy := math.Cos(altRad) * math.Cos(azRad)
+	dz := math.Sin(altRad)
+
+	o := scene.Telescope
+	for i := range scene.Walls {
+		if scene.Walls[i].hit(o, dx, dy, dz) {
+			return true
+		}
+	}
+	for i := range scene.Slabs {
+		if scene.Slabs[i].hit(o, dx, dy, dz) {
+			return true
+		}
+	}
+	return false
+}
+
+// AltitudeLimits scans the azimuth for the lowest and highest unobstructed
+// altitude. Gaps between them, e.g. a railing with a slit, are not reported.
+func (scene *Scene) AltitudeLimits(azimuth float64) (float64, float64) {
+	alphaMin, alphaMax := 90.0, -90.0
+	for alt := sceneScanStep; alt <= 90; alt += sceneScanStep {
+		if !scene.Blocks(alt, azimuth) {
+			alphaMin = math.Min(alphaMin, alt)
+			alphaMax = math.Max(alphaMax, alt)
+		}
+	}
+	return alphaMin, alphaMax
+}
+
+// hit reports whether the ray from o in direction (dx, dy, dz) crosses the wall
+func (w *Wall) hit(o Point3, dx, dy, dz float64) bool {
+	ex, ey := w.To.X-w.From.X, w.To.Y-w.From.Y
+	// Solve o + t*d = From + u*e in the floor plane
+	denom := dx*ey - dy*ex
+	if math.Abs(denom) < epsilon {
+		return false // ray parallel to the wall or vertical
+	}
+	fx, fy := w.From.X-o.X, w.From.Y-o.Y
+	t := (fx*ey - fy*ex) / denom
+	u := (fx*dy - fy*dx) / denom
+	if t <= 0 || u < 0 || u > 1 {
+		return false
+	}
+	// t is the distance along the floor plan scaled by cos(alt), so
+	// dz*t is the height gained at the wall
+	z := o.Z + dz*t
+	return z >= w.Bottom && z <= w.Top
+}
+
+// hit reports whether the ray from o in direction (dx, dy, dz) crosses the slab
+func (s *Slab) hit(o Point3, dx, dy, dz float64) bool {
+	if math.Abs(dz) < epsilon {
+		return false
+	}
+	t := (s.Height - o.Z) / dz
+	if t <= 0 {
+		return false
+	}
+	x, y := o.X+dx*t, o.Y+dy*t
+	if !insideOutline(s.Outline, x, y) {
+		return false
+	}
+	for _, opening := range s.Openings {
+		if insideOutline(opening, x, y) {
+			return false
+		}
+	}
+	return true
+}
+
+// insideOutline is the even-odd ray casting test
+func insideOutline(outline []Point2, x, y float64) bool {
+	inside := false
+	for i, j := 0, len(outline)-1; i < len(outline); j, i = i, i+1 {
+		a, b := outline[i], outline[j]
+		if (a.Y > y) != (b.Y > y) && x < (b.X-a.X)*(y-a.Y)/(b.Y-a.Y)+a.X {
+			inside = !inside
+		}
+	}
+	return inside
+}
@@ -0,0 +1,172 @@
+package visibility
+
+import (
+	"errors"
+	"time"
+)
+
+// ScheduleOptions controls the night scheduler. Blocks shorter than MinBlock
+// are not scheduled, and every block is preceded by Overhead for slewing and
+// framing. Priorities are looked up like for ranking; targets without one
+// have priority 0.
+type ScheduleOptions struct {
+	MinBlock   time.Duration
+	Overhead   time.Duration
+	Priorities map[string]float64
+}
+
+// Validate checks that the block length and the overhead are not negative
+func (options *ScheduleOptions) Validate() error {
+	if options.MinBlock < 0 {
+		return errors.New("minimum block must not be negative")
+	}
+	if options.Overhead < 0 {
+		return errors.New("overhead must not be negative")
+	}
+	return nil
+}
+
+// ScheduledBlock is a period assigned to one target. Imaging runs from
+// StartTime to EndTime, after Overhead of slewing and framing.
+type ScheduledBlock struct {
+	Object    AstroObject   `json:"object"`
+	StartTime time.Time     `json:"startTime"`
+	EndTime   time.Time     `json:"endTime"`
+	Overhead  time.Duration `json:"overhead"`
+	Priority  float64       `json:"priority"`
+}
+
+// Schedule is the timeline of one night: the assigned blocks in time order
+// and the gaps where no target could be imaged
+type Schedule struct {
+	Night        TimeRange        `json:"night"`
+	Blocks       []ScheduledBlock `json:"blocks"`
+	Gaps         []TimeRange      `json:"gaps"`
+	ImagingTime  time.Duration    `json:"imagingTime"`
+	OverheadTime time.Duration    `json:"overheadTime"`
+	UnusedTime   time.Duration    `json:"unusedTime"`
+}
+
+// ScheduleNights builds a schedule for every time range from the visibility
+// windows of the targets
+func ScheduleNights(infos []VisibilityInfo, timeRanges []TimeRange, options ScheduleOptions) []Schedule {
+	schedules := make([]Schedule, 0, len(timeRanges))
+	for _, timeRange := range timeRanges {
+		schedules = append(schedules, ScheduleNight(infos, timeRange, options))
+	}
+	return schedules
+}
+
+// candidate is the part of a visibility window a target can still be
+// imaged in
+type candidate struct {
+	object     AstroObject
+	priority   float64
+	start, end time.Time
+}
+
+// ScheduleNight sequences the targets through the night like a dispatcher:
+// whenever the telescope is free it takes the highest priority target that
+// can be imaged for at least MinBlock, preferring the one leaving the
+// opening first, and keeps it until it leaves or a higher priority target
+// becomes available. When nothing is available it waits for the next target
+// to enter. The dispatcher is greedy and does not look ahead, so it does not
+// guarantee the most imaging time of all possible orders.
+func ScheduleNight(infos []VisibilityInfo, night TimeRange, options ScheduleOptions) Schedule {
+	schedule := Schedule{Night: night, Blocks: []ScheduledBlock{}, Gaps: []TimeRange{}}
+	// A negative overhead would move the ready time back and pick the same
+	// window again forever
+	minBlock, overhead := max(options.MinBlock, time.Minute), max(options.Overhead, 0)
+
+	var windows []candidate
+	for _, info := range infos {
+		priority := priorityOf(options.Priorities, info.Object.Name)
+		for _, window := range info.VisibilityWindows {
+			start, end := maxTime(window.StartTime, night.StartTime), minTime(window.EndTime, night.EndTime)
+			if end.After(start) {
+				windows = append(windows, candidate{object: info.Object, priority: priority, start: start, end: end})
+			}
+		}
+	}
+
+	free := night.StartTime
+	for {
+		// Imaging can start after the slew, once the target is in the opening
+		available := func(c candidate) (time.Time, bool) {
+			start := maxTime(c.start, free.Add(overhead))
+			return start, c.end.Sub(start) >= minBlock
+		}
+		var best *candidate
+		var bestStart time.Time
+		for i := range windows {
+			c := &windows[i]
+			start, ok := available(*c)
+			if !ok {
+				continue
+			}
+			// Targets that can start right away go first, then the earliest
+			if best == nil || better(start, c, bestStart, best, free.Add(overhead)) {
+				best, bestStart = c, start
+			}
+		}
+		if best == nil {
+			break
+		}
+
+		// Hand over to a higher priority target when it enters, if the block
+		// is long enough by then and the target can still be imaged for
+		// MinBlock after the slew
+		end := best.end
+		for _, c := range windows {
+			if c.priority > best.priority && c.start.After(bestStart) && c.start.Before(end) && c.end.Sub(c.start.Add(overhead)) >= minBlock && c.start.Sub(bestStart) >= minBlock {
+				end = c.start
+			}
+		}
+
+		slewStart := bestStart.Add(-overhead)
+		if slewStart.After(free) {
+			schedule.Gaps = append(schedule.Gaps, TimeRange{StartTime: free, EndTime: slewStart})
+			schedule.UnusedTime += slewStart.Sub(free)
+		}
+		schedule.Blocks = append(schedule.Blocks, ScheduledBlock{Object: best.object, StartTime: bestStart, EndTime: end, Overhead: overhead, Priority: best.priority})
+		schedule.ImagingTime += end.Sub(bestStart)
+		schedule.OverheadTime += overhead
+		free = end
+	}
+	if night.EndTime.After(free) {
+		schedule.Gaps = append(schedule.Gaps, TimeRange{StartTime: free, EndTime: night.EndTime})
+		schedule.UnusedTime += night.EndTime.Sub(free)
+	}
+	return schedule
+}
+
+// better reports whether candidate c starting at start beats the best so
+// far. Targets ready by ready are ranked by priority and then by the time
+// they leave; otherwise the earliest start wins.
+func better(start time.Time, c *candidate, bestStart time.Time, best *candidate, ready time.Time) bool {
+	cReady, bestReady := !start.After(ready), !bestStart.After(ready)
+	if cReady != bestReady {
+		return cReady
+	}
+	if !cReady && !start.Equal(bestStart) {
+		return start.Before(bestStart)
+	}
+	if c.priority != best.priority {
+		return c.priority > best.priority
+	}
+	return c.end.Before(best.end)
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
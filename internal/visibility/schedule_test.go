@@ -0,0 +1,67 @@
+package visibility
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNight(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2025, 9, 1, hour, minute, 0, 0, time.UTC)
+	}
+	target := func(name string, start, end time.Time) VisibilityInfo {
+		return VisibilityInfo{Object: AstroObject{Name: name}, VisibilityWindows: []VisibilityWindow{{StartTime: start, EndTime: end}}}
+	}
+	infos := []VisibilityInfo{
+		target("low", at(20, 0), at(22, 0)),
+		target("high", at(21, 0), at(23, 0)),
+		target("late", at(22, 30), at(23, 30)),
+		target("short", at(20, 0), at(20, 20)),
+	}
+	night := TimeRange{StartTime: at(20, 0), EndTime: at(23, 59)}
+	options := ScheduleOptions{MinBlock: 30 * time.Minute, Overhead: 5 * time.Minute, Priorities: map[string]float64{"high": 5}}
+
+	schedule := ScheduleNight(infos, night, options)
+	want := []struct {
+		name       string
+		start, end time.Time
+	}{
+		{"low", at(20, 5), at(21, 0)},
+		{"high", at(21, 5), at(23, 0)},
+	}
+	if len(schedule.Blocks) != len(want) {
+		t.Fatalf("expected %d blocks, got %+v", len(want), schedule.Blocks)
+	}
+	for i, w := range want {
+		block := schedule.Blocks[i]
+		if block.Object.Name != w.name || !block.StartTime.Equal(w.start) || !block.EndTime.Equal(w.end) {
+			t.Errorf("block %d: %s %s - %s, want %s %s - %s", i, block.Object.Name, block.StartTime, block.EndTime, w.name, w.start, w.end)
+		}
+	}
+	// The late target has only 25 minutes left after the slew
+	if len(schedule.Gaps) != 1 || !schedule.Gaps[0].StartTime.Equal(at(23, 0)) {
+		t.Errorf("gaps %+v, want one from 23:00", schedule.Gaps)
+	}
+	if schedule.ImagingTime+schedule.OverheadTime+schedule.UnusedTime != night.EndTime.Sub(night.StartTime) {
+		t.Errorf("imaging %s, overhead %s and unused %s do not add up to the night", schedule.ImagingTime, schedule.OverheadTime, schedule.UnusedTime)
+	}
+
+	// A higher priority target too short to image after the slew does not
+	// interrupt the current block
+	infos = []VisibilityInfo{target("low", at(20, 0), at(22, 0)), target("high", at(21, 0), at(21, 32))}
+	schedule = ScheduleNight(infos, night, options)
+	if len(schedule.Blocks) != 1 || !schedule.Blocks[0].EndTime.Equal(at(22, 0)) {
+		t.Errorf("expected the low priority target to be imaged until 22:00, got %+v", schedule.Blocks)
+	}
+
+	// A negative overhead is rejected and scheduled as none
+	options = ScheduleOptions{MinBlock: 30 * time.Minute, Overhead: -time.Hour}
+	if options.Validate() == nil {
+		t.Error("expected an error for a negative overhead")
+	}
+	infos = []VisibilityInfo{target("a", at(20, 0), at(23, 0)), target("b", at(20, 0), at(20, 40))}
+	schedule = ScheduleNight(infos, TimeRange{StartTime: at(20, 0), EndTime: at(23, 0)}, options)
+	if len(schedule.Blocks) != 2 || schedule.OverheadTime != 0 {
+		t.Errorf("expected two blocks without overhead, got %+v", schedule.Blocks)
+	}
+}
@@ -0,0 +1,219 @@
+package visibility
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tps193/balcony-stargazer/internal/ephemeris"
+)
+
+// ScoreWeights sets how much each part of the score counts. Parts that
+// cannot be computed for an object, such as the fill without equipment, are
+// left out and the remaining weights are rescaled.
+type ScoreWeights struct {
+	Duration          float64 `json:"duration"`
+	Altitude          float64 `json:"altitude"`
+	MoonSeparation    float64 `json:"moonSeparation"`
+	Fill              float64 `json:"fill"`
+	SurfaceBrightness float64 `json:"surfaceBrightness"`
+	Priority          float64 `json:"priority"`
+	Exposure          float64 `json:"exposure"`
+}
+
+// Validate checks that no weight is negative and at least one is positive
+func (weights *ScoreWeights) Validate() error {
+	parts := []float64{weights.Duration, weights.Altitude, weights.MoonSeparation, weights.Fill, weights.SurfaceBrightness, weights.Priority, weights.Exposure}
+	sum := 0.0
+	for _, weight := range parts {
+		if weight < 0 {
+			return errors.New("score weights must not be negative")
+		}
+		sum += weight
+	}
+	if sum == 0 {
+		return errors.New("at least one score weight must be positive")
+	}
+	return nil
+}
+
+// UnmarshalJSON starts from DefaultScoreWeights, so weights left out of the
+// config keep their default instead of dropping to 0
+func (weights *ScoreWeights) UnmarshalJSON(data []byte) error {
+	type plain ScoreWeights
+	parsed := plain(DefaultScoreWeights)
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return err
+	}
+	*weights = ScoreWeights(parsed)
+	return nil
+}
+
+// DefaultScoreWeights weigh all parts equally
+var DefaultScoreWeights = ScoreWeights{Duration: 1, Altitude: 1, MoonSeparation: 1, Fill: 1, SurfaceBrightness: 1, Priority: 1, Exposure: 1}
+
+// maxPriority is the highest priority that can be given to an object
+const maxPriority = 10
+
+// Score ranks an object for the night. Every part is between 0 and 1, Total
+// is their weighted mean scaled to 0 to 100. Fill, SurfaceBrightness,
+// Priority and Exposure are nil when they are unknown.
+type Score struct {
+	Total             float64  `json:"total"`
+	Duration          float64  `json:"duration"`
+	Altitude          float64  `json:"altitude"`
+	MoonSeparation    float64  `json:"moonSeparation"`
+	Fill              *float64 `json:"fill,omitempty"`
+	SurfaceBrightness *float64 `json:"surfaceBrightness,omitempty"`
+	Priority          *float64 `json:"priority,omitempty"`
+	Exposure          *float64 `json:"exposure,omitempty"`
+}
+
+// ScoreOptions holds what scoring needs besides the visibility windows.
+// Configs supplies the position and sky quality of the config each window
+// was found with; Framing is used when it has equipment. With a Journal, objects score higher the further they are from
+// ExposureGoal.
+type ScoreOptions struct {
+	Weights      ScoreWeights
+	Configs      *ConfigArray
+	Framing      FramingOptions
+	Priorities   map[string]float64
+	Journal      *JournalIndex
+	ExposureGoal time.Duration
+}
+
+// ScoreOptions returns the scoring options of the config array, with the
+// default weights unless the config sets its own
+func (configArray *ConfigArray) ScoreOptions(framing FramingOptions) ScoreOptions {
+	options := ScoreOptions{Weights: DefaultScoreWeights, Configs: configArray, Framing: framing, Priorities: configArray.Priorities}
+	if configArray.Scoring != nil {
+		options.Weights = *configArray.Scoring
+	}
+	return options
+}
+
+// RankByScore scores every object and sorts them best first. The duration
+// is scored against the total length of the time ranges.
+func RankByScore(infos []VisibilityInfo, timeRanges []TimeRange, options ScoreOptions) {
+	var available time.Duration
+	for _, timeRange := range timeRanges {
+		available += timeRange.EndTime.Sub(timeRange.StartTime)
+	}
+	for i := range infos {
+		score := options.score(&infos[i], available)
+		infos[i].Score = &score
+	}
+	sort.SliceStable(infos, func(i, j int) bool {
+		return infos[i].Score.Total > infos[j].Score.Total
+	})
+}
+
+// score evaluates the object at the peak of its highest window
+func (options *ScoreOptions) score(info *VisibilityInfo, available time.Duration) Score {
+	var score Score
+	if len(info.VisibilityWindows) == 0 || options.Configs == nil {
+		return score
+	}
+	best := info.VisibilityWindows[0]
+	for _, window := range info.VisibilityWindows[1:] {
+		if window.PeakAlt > best.PeakAlt {
+			best = window
+		}
+	}
+	config := options.Configs.windowConfig(&best)
+	position := &config.Position
+	moon := moonAt(info.Object, position, best.PeakTime)
+
+	if available > 0 {
+		score.Duration = math.Min(info.TotalDuration.Minutes()/available.Minutes(), 1)
+	}
+	score.Altitude = math.Max(best.PeakAlt, 0) / 90
+	score.MoonSeparation = 1
+	if moon.altitude > 0 {
+		score.MoonSeparation = 1 - moon.illumination*(1-math.Min(moon.separation, 90)/90)
+	}
+	if options.Framing.Equipment != nil {
+		if framing, ok := options.Framing.Frame(info.Object); ok {
+			fill := framing.FillRatio
+			if fill > 1 {
+				fill = 1 / fill
+			}
+			score.Fill = &fill
+		}
+	}
+	if info.Object.SurfaceBrightness > 0 {
+		sunAltitude := ephemeris.SunAltitude(position.Latitude, position.Longitude, best.PeakTime)
+		sky := skyBrightness(config.zenithSkyBrightness(), best.PeakAlt, sunAltitude, moon)
+		// Objects as bright as the sky score 0.5, two magnitudes brighter 1
+		contrast := math.Max(0, math.Min(0.5+(sky-info.Object.SurfaceBrightness)/4, 1))
+		score.SurfaceBrightness = &contrast
+	}
+	if len(options.Priorities) > 0 {
+		priority := math.Max(0, math.Min(priorityOf(options.Priorities, info.Object.Name)/maxPriority, 1))
+		score.Priority = &priority
+	}
+	if options.Journal != nil && options.ExposureGoal > 0 {
+		exposure := 1 - math.Min(options.Journal.Summary(info.Object.Name).Total.Hours()/options.ExposureGoal.Hours(), 1)
+		score.Exposure = &exposure
+	}
+
+	weights := options.Weights
+	total := weights.Duration*score.Duration + weights.Altitude*score.Altitude + weights.MoonSeparation*score.MoonSeparation
+	sum := weights.Duration + weights.Altitude + weights.MoonSeparation
+	for _, part := range []struct {
+		value  *float64
+		weight float64
+	}{{score.Fill, weights.Fill}, {score.SurfaceBrightness, weights.SurfaceBrightness}, {score.Priority, weights.Priority}, {score.Exposure, weights.Exposure}} {
+		if part.value != nil {
+			total += part.weight * *part.value
+			sum += part.weight
+		}
+	}
+	if sum > 0 {
+		score.Total = 100 * total / sum
+	}
+	return score
+}
+
+// priorityOf looks the object up by its full name, its catalog name or one
+// of its common names
+func priorityOf(priorities map[string]float64, name string) float64 {
+	for _, key := range objectNames(name) {
+		if priority, ok := priorities[key]; ok {
+			return priority
+		}
+	}
+	return 0
+}
+
+// objectNames returns the names an object can be referred to by: its full
+// name, and for catalog objects named "Common names (NGC0224)" the catalog
+// name and every common name
+func objectNames(name string) []string {
+	names := []string{name}
+	open := strings.LastIndex(name, " (")
+	if open < 0 || !strings.HasSuffix(name, ")") {
+		return names
+	}
+	names = append(names, name[open+2:len(name)-1])
+	for _, common := range strings.Split(name[:open], ",") {
+		names = append(names, strings.TrimSpace(common))
+	}
+	return names
+}
+
+// Paginate returns the given page of pageSize objects, counting pages from
+// 1. A pageSize of 0 returns all objects.
+func Paginate(infos []VisibilityInfo, pageSize, page int) []VisibilityInfo {
+	if pageSize <= 0 {
+		return infos
+	}
+	start := (max(page, 1) - 1) * pageSize
+	if start >= len(infos) {
+		return nil
+	}
+	return infos[start:min(start+pageSize, len(infos))]
+}
@@ -0,0 +1,118 @@
+package visibility
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Site is a named observing location. Configs reference it by name instead
+// of repeating the position.
+type Site struct {
+	Name      string  `json:"name"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	// Elevation is in meters above sea level. It is informational only and
+	// not used in the calculations.
+	Elevation float64 `json:"elevation,omitempty"`
+	// Timezone is an IANA time zone name such as "America/Los_Angeles".
+	// Times are reported in it.
+	Timezone string `json:"timezone"`
+	// Bortle is the optional Bortle dark-sky class, 1 to 9
+	Bortle int `json:"bortle,omitempty"`
+	// SQM is the optional measured zenith sky brightness in mag/arcsec². It
+	// takes precedence over Bortle.
+	SQM float64 `json:"sqm,omitempty"`
+
+	location *time.Location
+}
+
+// ResolveSites links every config to its site and takes the position from
+// the site
+func (configArray *ConfigArray) ResolveSites() error {
+	for i := range configArray.Sites {
+		site := &configArray.Sites[i]
+		if site.Bortle < 0 || site.Bortle > 9 {
+			return fmt.Errorf("site %q: Bortle class must be between 1 and 9, got %d", site.Name, site.Bortle)
+		}
+		// LoadLocation returns UTC for an empty name
+		if site.Timezone == "" {
+			return fmt.Errorf("site %q needs an IANA timezone such as \"Europe/Paris\"", site.Name)
+		}
+		location, err := time.LoadLocation(site.Timezone)
+		if err != nil {
+			return fmt.Errorf("site %q: %w", site.Name, err)
+		}
+		site.location = location
+	}
+	for i := range configArray.Configs {
+		config := &configArray.Configs[i]
+		if config.Site == "" {
+			continue
+		}
+		site, ok := configArray.findSite(config.Site)
+		if !ok {
+			return fmt.Errorf("unknown site %q", config.Site)
+		}
+		config.site = site
+		config.Position = Position{Latitude: site.Latitude, Longitude: site.Longitude}
+	}
+	return nil
+}
+
+func (configArray *ConfigArray) findSite(name string) (*Site, bool) {
+	for i := range configArray.Sites {
+		if configArray.Sites[i].Name == name {
+			return &configArray.Sites[i], true
+		}
+	}
+	return nil, false
+}
+
+// Location returns the time zone of the config's site, nil without a site
+func (config *Config) Location() *time.Location {
+	if config.site == nil {
+		return nil
+	}
+	return config.site.location
+}
+
+// Location returns the time zone of the first config with a site, nil when
+// no config has one
+func (configArray *ConfigArray) Location() *time.Location {
+	if config := configArray.siteConfig(); config != nil {
+		return config.Location()
+	}
+	return nil
+}
+
+// siteConfig returns the first config with a site, nil when no config has
+// one
+func (configArray *ConfigArray) siteConfig() *Config {
+	for i := range configArray.Configs {
+		if configArray.Configs[i].site != nil {
+			return &configArray.Configs[i]
+		}
+	}
+	return nil
+}
+
+// localTimeLayout is accepted by ParseTime for times without an offset
+const localTimeLayout = "2006-01-02T15:04:05"
+
+// ParseTime parses a time in RFC3339 format, or without an offset
+// (2025-07-30T22:00:00) in the given site time zone
+func ParseTime(s string, location *time.Location) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err == nil {
+		return t, nil
+	}
+	local, localErr := time.Parse(localTimeLayout, s)
+	if localErr != nil {
+		return time.Time{}, err
+	}
+	if location == nil {
+		return time.Time{}, errors.New("time " + s + " has no offset and the config has no site with a timezone")
+	}
+	return time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), local.Minute(), local.Second(), 0, location), nil
+}
@@ -0,0 +1,168 @@
+package visibility
+
+import (
+	"math"
+	"time"
+
+	"github.com/tps193/balcony-stargazer/internal/ephemeris"
+)
+
+// defaultBortle is assumed for configs without a site sky quality
+const defaultBortle = 5
+
+// vExtinction is the typical V band extinction in magnitudes per airmass
+const vExtinction = 0.2
+
+// bortleSQM maps Bortle classes 1 to 9 to a typical zenith sky brightness in
+// mag/arcsec²
+var bortleSQM = [...]float64{21.9, 21.7, 21.4, 20.9, 20.1, 19.4, 18.9, 18.4, 17.8}
+
+// twilightSky maps the Sun altitude to the twilight sky brightness at the
+// zenith, interpolated linearly in magnitudes. Below -18° twilight adds
+// nothing.
+var twilightSky = []struct{ sunAltitude, mag float64 }{
+	{0, 7}, {-6, 13}, {-12, 19}, {-18, 23},
+}
+
+// SkySample is the estimated sky background at the object at one time
+type SkySample struct {
+	Time time.Time `json:"time"`
+	// Brightness is the sky background in mag/arcsec², larger is darker
+	Brightness float64 `json:"brightness"`
+	// LimitingMagnitude is the naked-eye limiting magnitude for this sky
+	LimitingMagnitude float64 `json:"limitingMagnitude"`
+}
+
+// SkyBrightness is the sky quality curve along a visibility window
+type SkyBrightness struct {
+	Samples []SkySample `json:"samples"`
+	// Darkest and Brightest are the extremes of the curve in mag/arcsec²
+	Darkest   float64 `json:"darkest"`
+	Brightest float64 `json:"brightest"`
+}
+
+// zenithSkyBrightness returns the moonless night sky brightness at the
+// zenith of the config's site in mag/arcsec²
+func (config *Config) zenithSkyBrightness() float64 {
+	if site := config.site; site != nil {
+		if site.SQM > 0 {
+			return site.SQM
+		}
+		if site.Bortle > 0 {
+			return bortleSQM[site.Bortle-1]
+		}
+	}
+	return bortleSQM[defaultBortle-1]
+}
+
+// nanoLamberts converts a surface brightness in mag/arcsec² to nanolamberts
+func nanoLamberts(mag float64) float64 {
+	return 34.08 * math.Exp(20.7233-0.92104*mag)
+}
+
+// magPerArcsec2 converts nanolamberts to a surface brightness in mag/arcsec²
+func magPerArcsec2(nl float64) float64 {
+	return (20.7233 - math.Log(nl/34.08)) / 0.92104
+}
+
+// skyAirmass is the airmass used by the Krisciunas and Schaefer moonlight
+// model for the given altitude
+func skyAirmass(altitude float64) float64 {
+	z := Deg2rad(90 - math.Max(altitude, 0))
+	return 1 / math.Sqrt(1-0.96*math.Sin(z)*math.Sin(z))
+}
+
+// skyBrightness estimates the sky background in mag/arcsec² at an object at
+// the given altitude. The moonless sky brightens towards the horizon, and
+// scattered moonlight (Krisciunas and Schaefer 1991) and twilight are added.
+func skyBrightness(zenith, altitude, sunAltitude float64, moon moonState) float64 {
+	x := skyAirmass(altitude)
+	// Airglow grows with the airmass while extinction dims it again
+	total := nanoLamberts(zenith - 2.5*math.Log10(x) + vExtinction*(x-1))
+
+	if moon.altitude > 0 {
+		phaseAngle := Rad2deg(math.Acos(2*moon.illumination - 1))
+		moonMag := -12.73 + 0.026*phaseAngle + 4e-9*math.Pow(phaseAngle, 4)
+		illuminance := math.Pow(10, -0.4*(moonMag+16.57))
+		rho := moon.separation
+		cos := math.Cos(Deg2rad(rho))
+		scattering := math.Pow(10, 5.36)*(1.06+cos*cos) + math.Pow(10, 6.15-rho/40)
+		total += scattering * illuminance * math.Pow(10, -0.4*vExtinction*skyAirmass(moon.altitude)) * (1 - math.Pow(10, -0.4*vExtinction*x))
+	}
+
+	if sunAltitude > twilightSky[len(twilightSky)-1].sunAltitude {
+		total += nanoLamberts(interpolateTwilight(sunAltitude))
+	}
+	return magPerArcsec2(total)
+}
+
+func interpolateTwilight(sunAltitude float64) float64 {
+	if sunAltitude >= twilightSky[0].sunAltitude {
+		return twilightSky[0].mag
+	}
+	for i := 1; i < len(twilightSky); i++ {
+		hi, lo := twilightSky[i-1], twilightSky[i]
+		if sunAltitude >= lo.sunAltitude {
+			f := (sunAltitude - lo.sunAltitude) / (hi.sunAltitude - lo.sunAltitude)
+			return lo.mag + f*(hi.mag-lo.mag)
+		}
+	}
+	return twilightSky[len(twilightSky)-1].mag
+}
+
+// limitingMagnitude returns the naked-eye limiting magnitude for a sky
+// brightness in mag/arcsec² (Schaefer)
+func limitingMagnitude(sky float64) float64 {
+	return 7.93 - 5*math.Log10(math.Pow(10, 4.316-sky/5)+1)
+}
+
+// AnalyzeSkyBrightness fills in the sky quality curve of every window, using
+// the sky quality of the site of the window's config, the Moon, twilight and
+// the object's altitude
+func AnalyzeSkyBrightness(infos []VisibilityInfo, configArray *ConfigArray) {
+	for i := range infos {
+		object := infos[i].Object
+		for j := range infos[i].VisibilityWindows {
+			window := &infos[i].VisibilityWindows[j]
+			config := configArray.windowConfig(window)
+			zenith := config.zenithSkyBrightness()
+			position := &config.Position
+			sky := &SkyBrightness{Darkest: math.Inf(-1), Brightest: math.Inf(1)}
+			for t := window.StartTime; !t.After(window.EndTime); t = t.Add(5 * time.Minute) {
+				alt, _ := radecToAltAz(object, position, t)
+				brightness := skyBrightness(zenith, alt, ephemeris.SunAltitude(position.Latitude, position.Longitude, t), moonAt(object, position, t))
+				sky.Samples = append(sky.Samples, SkySample{Time: t, Brightness: brightness, LimitingMagnitude: limitingMagnitude(brightness)})
+				sky.Darkest = math.Max(sky.Darkest, brightness)
+				sky.Brightest = math.Min(sky.Brightest, brightness)
+			}
+			window.Sky = sky
+		}
+	}
+}
+
+// FilterBySurfaceBrightness drops objects whose surface brightness is more
+// than margin mag/arcsec² fainter than the sky during all of their windows.
+// Objects without a known surface brightness or without a sky curve are
+// kept.
+func FilterBySurfaceBrightness(infos []VisibilityInfo, margin float64) []VisibilityInfo {
+	var kept []VisibilityInfo
+	for _, info := range infos {
+		if info.Object.SurfaceBrightness <= 0 || info.darkestSky() == 0 || info.Object.SurfaceBrightness <= info.darkestSky()+margin {
+			kept = append(kept, info)
+			continue
+		}
+		logger.Debug("lost in the sky, skipping", "object", info.Object.Name, "surfaceBrightness", info.Object.SurfaceBrightness, "sky", info.darkestSky())
+	}
+	return kept
+}
+
+// darkestSky returns the darkest sky of all windows, 0 without sky curves
+func (info *VisibilityInfo) darkestSky() float64 {
+	darkest := 0.0
+	for _, window := range info.VisibilityWindows {
+		if window.Sky != nil && len(window.Sky.Samples) > 0 {
+			darkest = math.Max(darkest, window.Sky.Darkest)
+		}
+	}
+	return darkest
+}
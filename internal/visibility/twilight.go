@@ -0,0 +1,38 @@
+package visibility
+
+import (
+	"errors"
+	"time"
+
+	"github.com/tps193/balcony-stargazer/internal/ephemeris"
+)
+
+// DarkTimeRanges returns the dark part of every night starting on the dates
+// from from to to, both included, at the site of the first config that has
+// one. Nights without dark time at the darkness level are left out.
+func (configArray *ConfigArray) DarkTimeRanges(from, to time.Time, darkness ephemeris.Darkness) ([]TimeRange, error) {
+	config := configArray.siteConfig()
+	if config == nil {
+		return nil, errors.New("dark time needs a config with a site and its timezone")
+	}
+	location, position := config.Location(), config.Position
+	var timeRanges []TimeRange
+	for _, night := range ephemeris.DarkNights(position.Latitude, position.Longitude, from, to, location, darkness) {
+		if !night.IsDark() {
+			logger.Debug("no dark time", "date", night.Date, "darkness", darkness)
+			continue
+		}
+		// Whole minutes inside the dark time keep the time steps readable
+		start := night.Dusk.Add(time.Minute - 1).Truncate(time.Minute)
+		timeRanges = append(timeRanges, TimeRange{StartTime: start, EndTime: night.Dawn.Truncate(time.Minute)})
+	}
+	return timeRanges, nil
+}
+
+// nightDate returns the date of the night a dark time starting at start
+// belongs to. Nights run from noon to noon in the site's timezone, so dark
+// time starting after midnight belongs to the date before.
+func nightDate(start time.Time) time.Time {
+	year, month, day := start.Add(-12 * time.Hour).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, start.Location())
+}
@@ -1,20 +1,31 @@
 package visibility
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"math"
 	"sort"
 	"time"
+
+	"github.com/tps193/balcony-stargazer/internal/logging"
 )
 
-const epsilon = 1e-7 // Small value to avoid division by zero
-const minObservableAltitude = 20.0
-const maxObservableAltitude = 80.0
+var logger = logging.New("visibility")
+
+const epsilon = 1e-7               // Small value to avoid division by zero
+const minObservableAltitude = 20.0 // used by DefaultMountProfile
+const maxObservableAltitude = 80.0 // used by DefaultMountProfile
 
 type VisibilityInfo struct {
 	Object            AstroObject        `json:"object"`
 	VisibilityWindows []VisibilityWindow `json:"visibilityWindows"`
 	TotalDuration     time.Duration      `json:"totalDuration"`
+	// Framing is filled in by AnalyzeFraming
+	Framing *Framing `json:"framing,omitempty"`
+	// Score is filled in by RankByScore
+	Score *Score `json:"score,omitempty"`
+	// Journal is filled in by AnalyzeJournal
+	Journal *JournalSummary `json:"journal,omitempty"`
 }
 
 type VisibilityWindow struct {
@@ -22,44 +33,148 @@ type VisibilityWindow struct {
 	EndTime   time.Time `json:"endTime"`
 	StartAlt  float64   `json:"startAlt"`
 	EndAlt    float64   `json:"endAlt"`
+	// MinAz to MaxAz, clockwise, is the azimuth range the object crosses
+	// during the window. MinAz is larger than MaxAz when the range crosses
+	// north; the full circle is 0 to 360.
+	MinAz float64 `json:"minAz"`
+	MaxAz float64 `json:"maxAz"`
+	// PeakAlt is the highest altitude reached during the window, at PeakTime
+	PeakAlt  float64   `json:"peakAlt"`
+	PeakTime time.Time `json:"peakTime"`
+	// MinAirmass is the airmass at the peak, MaxAirmass at the lowest point
+	MinAirmass float64 `json:"minAirmass"`
+	MaxAirmass float64 `json:"maxAirmass"`
+	// Clearance is the worst clearance of the aperture during the window:
+	// fully clear, or vignetted by the largest part covered by the fence or
+	// window edges. Steps where only a part of the object is clear are
+	// reported by MinClearPercent instead.
+	Clearance Clearance `json:"clearance"`
+	// MinClearPercent is the smallest unobstructed part of the object or
+	// frame during the window, set when Filter.MinClearPercent is
+	MinClearPercent float64 `json:"minClearPercent,omitempty"`
+	// PierSide is set for equatorial mounts. FlipTime marks the meridian flip
+	// that ends or starts the window.
+	PierSide PierSide   `json:"pierSide,omitempty"`
+	FlipTime *time.Time `json:"flipTime,omitempty"`
+	// ConfigIndex is the index in ConfigArray.Configs of the config the
+	// window was found with. Windows are merged only with windows of configs
+	// at the same position and site, so the analysis of a window uses the
+	// position and sky of this config.
+	ConfigIndex int `json:"configIndex"`
+	// FieldRotation is filled in by AnalyzeFieldRotation
+	FieldRotation *FieldRotation `json:"fieldRotation,omitempty"`
+	// Moon is filled in by AnalyzeMoon
+	Moon *MoonInfo `json:"moon,omitempty"`
+	// Sky is filled in by AnalyzeSkyBrightness
+	Sky *SkyBrightness `json:"sky,omitempty"`
+	// Extinction is filled in by AnalyzeExtinction
+	Extinction *Extinction `json:"extinction,omitempty"`
 }
 
-// TODO: validate that time is in UTC
+// CalculateAltitudeVisibility finds the visibility windows of the objects in
+// the time ranges. Time ranges may be given in any zone; windows are reported
+// in the time zone of the config's site, or in the zone of the time range for
+// configs without a site.
 func CalculateAltitudeVisibility(astroObjects *AstroObjectArray, configArray *ConfigArray, timeRanges []TimeRange, stepInMinutes time.Duration, filter Filter, printVisibleOnly bool) []VisibilityInfo {
 	var allInfo []VisibilityInfo
 	for _, astroObject := range astroObjects.Objects {
 		allWindows := make([]VisibilityWindow, 0)
-		for _, config := range configArray.Configs {
+		for configIndex, config := range configArray.Configs {
 			visibilityWindows := make([]VisibilityWindow, 0)
-			// Implement log output showing config info
-			log.Printf("Config: %+v\n", config)
+			if logger.Enabled(context.Background(), slog.LevelDebug) {
+				logger.Debug("evaluating config", "object", astroObject.Name, "config", config)
+			}
 			if !ObjectNeverVisible(astroObject, &config) && ObjectEverInAzimuthWindow(astroObject, &config) {
 				var lastVisibilityWindow *VisibilityWindow
-				min, max := getTelescopeMinMaxAltitute(&config, config.DirectAzimuth)
-				log.Printf("Telescope min altitude: %.2f°, max altitude: %.2f° at %f° azimuth\n", min, max, config.DirectAzimuth)
-				log.Println("Start visibility calculation cycle")
+				obstructions := config.Obstructions()
+				mount := config.MountProfile()
+				pointing := mount.altitudeRange()
+				samples := extentSamples(astroObject, &filter)
+				if logger.Enabled(context.Background(), slog.LevelDebug) {
+					min, max := visibleAltitudeRange(obstructions, config.DirectAzimuth)
+					logger.Debug("telescope altitude limits", "min", min, "max", max, "azimuth", config.DirectAzimuth)
+				}
+				location := config.Location()
 				for _, timeRange := range timeRanges {
-					for t := timeRange.StartTime; t.Before(timeRange.EndTime) || t.Equal(timeRange.EndTime); t = t.Add(stepInMinutes * time.Minute) {
-						log.Println("Calculating visibility for time:", t.Format(time.RFC3339))
+					start := timeRange.StartTime
+					if location != nil {
+						start = start.In(location)
+					}
+					for t := start; t.Before(timeRange.EndTime) || t.Equal(timeRange.EndTime); t = t.Add(stepInMinutes * time.Minute) {
 						alt, az := radecToAltAz(astroObject, &config.Position, t)
-						// log.Printf("Altitude: %.2f°, Azimuth: %.2f°\n", alt, az)
-						visible := isVisible(alt, az, &config)
+						clearance := lineOfSight(alt, az, obstructions)
+						// With samples the clear part of the object decides below,
+						// also when its center is behind an obstruction, as long as
+						// the mount can point at it
+						visible := isVisible(clearance, &filter) || (samples != nil && clearance.Status == ClearanceBlocked && !pointing.Blocks(alt, az))
+						airmass := Airmass(alt)
+						if visible && filter.MaxAirmass > 0 {
+							visible = airmass <= filter.MaxAirmass
+						}
+
+						if visible && filter.MoonAvoidance != nil {
+							visible = filter.MoonAvoidance.allows(moonAt(astroObject, &config.Position, t))
+						}
+
+						var clear float64
+						if visible && samples != nil {
+							clear = clearPercent(samples, &config.Position, t, obstructions)
+							visible = clear >= filter.MinClearPercent
+						}
+
+						var pierSide PierSide
+						if visible && mount.Tracking == TrackingEquatorial {
+							var reachable bool
+							pierSide, reachable = mount.pierSide(hourAngle(astroObject, &config.Position, t))
+							visible = reachable && config.allowsPierSide(pierSide)
+						}
 
 						if lastVisibilityWindow != nil {
 							lastVisibilityWindow.EndAlt = alt
+							lastVisibilityWindow.widenAzimuth(az, az)
 							lastVisibilityWindow.EndTime = t
 						}
 
 						if visible {
-							log.Printf("Object is visible at azimuth %.2f° and altitude %.2f°\n", az, alt)
+							if lastVisibilityWindow != nil && lastVisibilityWindow.PierSide != pierSide {
+								// Meridian flip: split the window at the first step on the new side
+								flipTime := t
+								lastVisibilityWindow.FlipTime = &flipTime
+								endVisibilityWindow(&lastVisibilityWindow, &visibilityWindows)
+								lastVisibilityWindow = &VisibilityWindow{
+									StartTime: t,
+									StartAlt:  alt,
+									EndAlt:    alt,
+									MinAz:     az,
+									MaxAz:     az,
+									EndTime:   t,
+									PierSide:  pierSide,
+									FlipTime:  &flipTime,
+								}
+							}
 							if lastVisibilityWindow == nil {
 								lastVisibilityWindow = &VisibilityWindow{
 									StartTime: t,
 									StartAlt:  alt,
 									EndAlt:    alt,
+									MinAz:     az,
+									MaxAz:     az,
 									EndTime:   t,
+									PierSide:  pierSide,
 								}
 							}
+							if lastVisibilityWindow.MinAirmass == 0 || alt > lastVisibilityWindow.PeakAlt {
+								lastVisibilityWindow.PeakAlt = alt
+								lastVisibilityWindow.PeakTime = t
+								lastVisibilityWindow.MinAirmass = airmass
+							}
+							lastVisibilityWindow.MaxAirmass = math.Max(lastVisibilityWindow.MaxAirmass, airmass)
+							if clearance.Status != ClearanceBlocked {
+								lastVisibilityWindow.Clearance = lastVisibilityWindow.Clearance.worst(clearance)
+							}
+							if samples != nil && (lastVisibilityWindow.MinClearPercent == 0 || clear < lastVisibilityWindow.MinClearPercent) {
+								lastVisibilityWindow.MinClearPercent = clear
+							}
 						} else if lastVisibilityWindow != nil {
 							endVisibilityWindow(&lastVisibilityWindow, &visibilityWindows)
 						}
@@ -69,22 +184,25 @@ func CalculateAltitudeVisibility(astroObjects *AstroObjectArray, configArray *Co
 					}
 				}
 			} else {
-				log.Printf("Object %s is never visible from the given location and configuration.\n", astroObject.Name)
+				logger.Debug("object is never visible with config", "object", astroObject.Name)
+			}
+			for i := range visibilityWindows {
+				visibilityWindows[i].ConfigIndex = configIndex
 			}
 			allWindows = append(allWindows, visibilityWindows...)
 		}
 		// Merge overlapping windows from all configs
-		merged := mergeVisibilityWindows(allWindows)
+		merged := mergeVisibilityWindows(allWindows, configArray.Configs)
 
 		if printVisibleOnly && len(merged) == 0 {
-			log.Printf("Object %s has no visibility windows after merging, skipping.\n", astroObject.Name)
+			logger.Debug("no visibility windows, skipping", "object", astroObject.Name)
 			continue
 		}
 
 		totalDuration := calculateTotalVisibility(merged)
 
 		if totalDuration.Minutes() < float64(filter.MinVisibilityDurationMinutes) {
-			log.Printf("Object %s total visibility duration %.2f minutes is less than minimum %d minutes, skipping.\n", astroObject.Name, totalDuration.Minutes(), filter.MinVisibilityDurationMinutes)
+			logger.Debug("visibility shorter than minimum, skipping", "object", astroObject.Name, "minutes", totalDuration.Minutes(), "minMinutes", filter.MinVisibilityDurationMinutes)
 			continue
 		}
 
@@ -99,16 +217,30 @@ func CalculateAltitudeVisibility(astroObjects *AstroObjectArray, configArray *Co
 	return allInfo
 }
 
+// calculateTotalVisibility returns the time covered by the windows, which
+// must be sorted by start time. Windows on different pier sides, e.g. from
+// an alt-az and an equatorial config, may overlap and are counted once.
 func calculateTotalVisibility(windows []VisibilityWindow) time.Duration {
 	var total time.Duration
+	var coveredUntil time.Time
 	for _, window := range windows {
-		total += window.EndTime.Sub(window.StartTime)
+		start := window.StartTime
+		if start.Before(coveredUntil) {
+			start = coveredUntil
+		}
+		if window.EndTime.After(start) {
+			total += window.EndTime.Sub(start)
+			coveredUntil = window.EndTime
+		}
 	}
 	return total
 }
 
-// mergeVisibilityWindows merges overlapping or adjacent visibility windows into a single list
-func mergeVisibilityWindows(windows []VisibilityWindow) []VisibilityWindow {
+// mergeVisibilityWindows merges overlapping or adjacent visibility windows into a single list.
+// Windows on different pier sides, or of configs at different positions or
+// sites, are kept apart. A merged window keeps the ConfigIndex of its
+// earliest part.
+func mergeVisibilityWindows(windows []VisibilityWindow, configs []Config) []VisibilityWindow {
 	if len(windows) == 0 {
 		return nil
 	}
@@ -118,13 +250,35 @@ func mergeVisibilityWindows(windows []VisibilityWindow) []VisibilityWindow {
 	})
 	merged := []VisibilityWindow{windows[0]}
 	for i := 1; i < len(windows); i++ {
-		last := &merged[len(merged)-1]
 		curr := windows[i]
-		if curr.StartTime.Before(last.EndTime) || curr.StartTime.Equal(last.EndTime) { // Overlapping or adjacent
+		// Windows that are kept apart may interleave, so look for the latest
+		// window curr can be merged with
+		var last *VisibilityWindow
+		for j := len(merged) - 1; j >= 0; j-- {
+			if merged[j].PierSide == curr.PierSide && sameSky(&configs[merged[j].ConfigIndex], &configs[curr.ConfigIndex]) {
+				last = &merged[j]
+				break
+			}
+		}
+		if last != nil && (curr.StartTime.Before(last.EndTime) || curr.StartTime.Equal(last.EndTime)) { // Overlapping or adjacent
 			if curr.EndTime.After(last.EndTime) {
 				last.EndTime = curr.EndTime
 				last.EndAlt = curr.EndAlt
 			}
+			last.widenAzimuth(curr.MinAz, curr.MaxAz)
+			if curr.PeakAlt > last.PeakAlt {
+				last.PeakAlt = curr.PeakAlt
+				last.PeakTime = curr.PeakTime
+				last.MinAirmass = curr.MinAirmass
+			}
+			last.MaxAirmass = math.Max(last.MaxAirmass, curr.MaxAirmass)
+			last.Clearance = last.Clearance.worst(curr.Clearance)
+			if curr.MinClearPercent > 0 && (last.MinClearPercent == 0 || curr.MinClearPercent < last.MinClearPercent) {
+				last.MinClearPercent = curr.MinClearPercent
+			}
+			if last.FlipTime == nil {
+				last.FlipTime = curr.FlipTime
+			}
 		} else {
 			merged = append(merged, curr)
 		}
@@ -132,13 +286,47 @@ func mergeVisibilityWindows(windows []VisibilityWindow) []VisibilityWindow {
 	return merged
 }
 
+// widenAzimuth extends the azimuth range of the window by the clockwise range
+// from minAz to maxAz, going the shorter way around
+func (window *VisibilityWindow) widenAzimuth(minAz, maxAz float64) {
+	width, otherWidth := azimuthSpan(window.MinAz, window.MaxAz), azimuthSpan(minAz, maxAz)
+	// The smallest range covering both starts at one of their starts
+	start, span := window.MinAz, math.Max(width, normalize360(minAz-window.MinAz)+otherWidth)
+	if other := math.Max(otherWidth, normalize360(window.MinAz-minAz)+width); other < span {
+		start, span = minAz, other
+	}
+	if span >= 360 {
+		window.MinAz, window.MaxAz = 0, 360
+		return
+	}
+	window.MinAz, window.MaxAz = start, normalize360(start+span)
+}
+
+// azimuthSpan returns the width of the clockwise range from minAz to maxAz
+func azimuthSpan(minAz, maxAz float64) float64 {
+	if maxAz < minAz {
+		return maxAz + 360 - minAz
+	}
+	return maxAz - minAz
+}
+
+// sameSky reports whether two configs observe from the same position and
+// site, so their windows share the Moon, the sky brightness and the time zone
+func sameSky(a, b *Config) bool {
+	return a.Position == b.Position && a.Site == b.Site
+}
+
+// windowConfig returns the config a visibility window was found with
+func (configArray *ConfigArray) windowConfig(window *VisibilityWindow) *Config {
+	return &configArray.Configs[window.ConfigIndex]
+}
+
 func ObjectNeverVisible(astroObject AstroObject, config *Config) bool {
 	// Calculate the maximum altitude the object can reach
 	declinationRad := Deg2rad(astroObject.Dec.toDegree())
 	latitudeRad := Deg2rad(config.Position.Latitude)
 	maxAltitude := Rad2deg(math.Asin(math.Sin(declinationRad)*math.Sin(latitudeRad) + math.Cos(declinationRad)*math.Cos(latitudeRad)))
-	log.Printf("Maximum altitude of the object: %.2f°\n", maxAltitude)
-	return maxAltitude < minObservableAltitude // Assuming 20 degrees is the minimum observable altitude
+	return maxAltitude < config.MountProfile().MinAltitude
 }
 
 // Quick check if the object ever comes into the visible azimuth window
@@ -147,10 +335,13 @@ func ObjectEverInAzimuthWindow(astroObject AstroObject, config *Config) bool {
 	if ObjectNeverVisible(astroObject, config) {
 		return false
 	}
+	if !config.hasAzimuthLimits() {
+		return true
+	}
 
 	lat := Deg2rad(config.Position.Latitude)
 	dec := Deg2rad(astroObject.Dec.toDegree())
-	minAlt := Deg2rad(minObservableAltitude) // Minimum observable altitude
+	minAlt := Deg2rad(config.MountProfile().MinAltitude) // Minimum observable altitude
 
 	// Calculate hour angle when object is at min observable altitude
 	cosH := (math.Sin(minAlt) - math.Sin(lat)*math.Sin(dec)) / (math.Cos(lat) * math.Cos(dec))
@@ -195,45 +386,17 @@ func endVisibilityWindow(lastVisibilityWindow **VisibilityWindow, visibilityWind
 	*lastVisibilityWindow = nil
 }
 
-func isVisible(objectAltitute float64, objectAzimuth float64, config *Config) bool {
-	isAzimuthVisible := isClockwise(config.LeftAzimuthLimit, objectAzimuth) && isClockwise(objectAzimuth, config.RightAzimuthLimit)
-	if !isAzimuthVisible {
-		log.Printf("Not visible. Azimuth %.2f° is outside of limits [%.2f°, %.2f°]\n", objectAzimuth, config.LeftAzimuthLimit, config.RightAzimuthLimit)
-		return false
-	}
-	alphaMin, alphaMax := getTelescopeMinMaxAltitute(config, objectAzimuth)
-	log.Printf("Telescope min altitude: %.2f°, max altitude: %.2f° at %f° azimuth\n", alphaMin, alphaMax, objectAzimuth)
-	if objectAltitute < minObservableAltitude || objectAltitute > maxObservableAltitude {
-		log.Printf("Not visible. Altitude %.2f° is outside of limits [%.2f°, %.2f°]\n", objectAltitute, minObservableAltitude, maxObservableAltitude)
-		return false
-	}
-	isAltitudeVisible := objectAltitute >= alphaMin && objectAltitute <= alphaMax
-	if !isAltitudeVisible {
-		log.Printf("Not visible. Altitude %.2f° is outside of limits [%.2f°, %.2f°]\n", objectAltitute, alphaMin, alphaMax)
+// isVisible decides whether a time step with the given clearance belongs to
+// a visibility window. Blocked steps never do; vignetted ones up to the
+// filter's limit. The clearance itself is reported on the window.
+func isVisible(clearance Clearance, filter *Filter) bool {
+	if clearance.Status == ClearanceBlocked {
 		return false
 	}
-	return true
+	return clearance.VignettedPercent <= filter.MaxVignettingPercent
 }
 
 func isClockwise(leftAzimuth, rightAzimuth float64) bool {
 	diff := math.Mod((rightAzimuth - leftAzimuth + 360), 360)
-	log.Printf("Clockwise check: leftAzimuth=%.2f°, rightAzimuth=%.2f°, diff=%.2f°\n", leftAzimuth, rightAzimuth, diff)
 	return diff > 0 && diff < 180
 }
-
-func getTelescopeMinMaxAltitute(config *Config, objectAzimuth float64) (float64, float64) {
-	angleDiff := Deg2rad(math.Abs(objectAzimuth - config.DirectAzimuth))
-	if angleDiff > 180 {
-		angleDiff = 360 - angleDiff
-	}
-	alphaMin := altitudeAtAzimuthDiff(config.FenceHeight-config.TelescopeHeight, config.DistanceToFence, angleDiff)
-	alphaMax := altitudeAtAzimuthDiff(config.WindowHeight+config.FenceHeight-config.TelescopeHeight, config.DistanceToFence, angleDiff)
-	return Rad2deg(alphaMin), Rad2deg(alphaMax)
-}
-
-func altitudeAtAzimuthDiff(actualFenceHeight, distanceToFence, angleDiff float64) float64 {
-	if actualFenceHeight <= 0 {
-		actualFenceHeight = epsilon // Avoid division by zero
-	}
-	return math.Atan(actualFenceHeight * math.Cos(angleDiff) / distanceToFence)
-}
@@ -0,0 +1,756 @@
+package visibility
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/tps193/balcony-stargazer/internal/ephemeris"
+	"github.com/tps193/balcony-stargazer/internal/spatial"
+)
+
+var testConfig = Config{
+	FenceHeight:       43.25,
+	WindowHeight:      62.0,
+	DistanceToFence:   35,
+	TelescopeHeight:   18.0,
+	DirectAzimuth:     80.0,
+	Position:          Position{Latitude: 37.38, Longitude: -121.89},
+	LeftAzimuthLimit:  13.0,
+	RightAzimuthLimit: 120.0,
+}
+
+// m31 transits high in the south at testConfig's position
+var m31 = AstroObject{Name: "M31", Ra: RightAscension{Hour: 0, Min: 42, Sec: 44}, Dec: Declination{Degree: 41, Min: 16, Sec: 9}}
+
+func TestIsVisibleDoesNotAllocate(t *testing.T) {
+	object := AstroObject{Name: "Ghost of Cassiopeia", Ra: RightAscension{Hour: 0, Min: 59, Sec: 59}, Dec: Declination{Degree: 60}}
+	when := time.Date(2025, 7, 31, 8, 0, 0, 0, time.UTC)
+	obstructions := testConfig.Obstructions()
+	vignetted := &Fence{Height: 43.25, WindowHeight: 62, Distance: 35, TelescopeHeight: 18, DirectAzimuth: 80, Telescope: TelescopeGeometry{ApertureDiameter: 5, PivotOffset: 10}}
+	allocs := testing.AllocsPerRun(100, func() {
+		alt, az := radecToAltAz(object, &testConfig.Position, when)
+		lineOfSight(alt, az, obstructions)
+		lineOfSight(45, 200, obstructions)
+		lineOfSight(10, 80, obstructions)
+		vignetted.BlockedFraction(36, 80)
+	})
+	if allocs != 0 {
+		t.Errorf("expected no allocations at the default log level, got %.1f", allocs)
+	}
+}
+
+func TestDeclinationToDegree(t *testing.T) {
+	for _, tc := range []struct {
+		dec  string
+		want float64
+	}{
+		{"+05:23:00", 5.3833},
+		{"-05:23:00", -5.3833},
+		{"-00:30:00", -0.5},
+	} {
+		dec, err := parseCatalogDec(tc.dec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := dec.toDegree(); math.Abs(got-tc.want) > 1e-4 {
+			t.Errorf("%s = %.4f°, want %.4f°", tc.dec, got, tc.want)
+		}
+	}
+}
+
+func TestHorizonMaskLimits(t *testing.T) {
+	fifty := 50.0
+	mask := HorizonMask{
+		{Azimuth: 350, MinAltitude: 10},
+		{Azimuth: 90, MinAltitude: 30, MaxAltitude: &fifty},
+		{Azimuth: 10, MinAltitude: 20},
+	}
+	tests := []struct {
+		azimuth, wantMin, wantMax float64
+	}{
+		{350, 10, 90},
+		{0, 15, 90},  // between 350 and 10 across north
+		{50, 25, 70}, // halfway between 10 and 90
+		{90, 30, 50},
+		{220, 20, 70}, // halfway between 90 and 350
+	}
+	for _, tt := range tests {
+		gotMin, gotMax := mask.AltitudeLimits(tt.azimuth)
+		if math.Abs(gotMin-tt.wantMin) > 1e-9 || math.Abs(gotMax-tt.wantMax) > 1e-9 {
+			t.Errorf("AltitudeLimits(%v) = (%v, %v), want (%v, %v)", tt.azimuth, gotMin, gotMax, tt.wantMin, tt.wantMax)
+		}
+	}
+}
+
+func TestHorizonMaskWithoutFence(t *testing.T) {
+	config := Config{
+		Position:    testConfig.Position,
+		HorizonMask: HorizonMask{{Azimuth: 0, MinAltitude: 30}, {Azimuth: 180, MinAltitude: 50}},
+	}
+	obstructions := config.Obstructions()
+	if lineOfSight(40, 10, obstructions).Status != ClearanceClear {
+		t.Errorf("expected altitude 40° at azimuth 10° above the mask to be visible")
+	}
+	if lineOfSight(40, 170, obstructions).Status != ClearanceBlocked {
+		t.Errorf("expected altitude 40° at azimuth 170° below the mask to be blocked")
+	}
+}
+
+func TestSceneLineOfSight(t *testing.T) {
+	// Balcony facing north: railing 1 m in front, side wall to the east and
+	// the balcony above covering the first 1.5 m
+	scene := Scene{
+		Telescope: Point3{X: 0, Y: 0, Z: 0.5},
+		Walls: []Wall{
+			{From: Point2{X: -3, Y: 1}, To: Point2{X: 3, Y: 1}, Bottom: 0, Top: 1},
+			{From: Point2{X: 1, Y: -2}, To: Point2{X: 1, Y: 1}, Bottom: 0, Top: 2.5},
+		},
+		Slabs: []Slab{
+			{Height: 2.5, Outline: []Point2{{X: -3, Y: -2}, {X: 3, Y: -2}, {X: 3, Y: 1.5}, {X: -3, Y: 1.5}}},
+		},
+	}
+	tests := []struct {
+		name             string
+		altitude, azimut float64
+		blocked          bool
+	}{
+		{"below railing", 10, 0, true},
+		{"over railing", 45, 0, false},
+		{"ceiling", 70, 0, true},
+		{"side wall", 30, 90, true},
+		{"behind", 30, 180, false},
+	}
+	for _, tt := range tests {
+		if got := scene.Blocks(tt.altitude, tt.azimut); got != tt.blocked {
+			t.Errorf("%s: Blocks(%v, %v) = %v, want %v", tt.name, tt.altitude, tt.azimut, got, tt.blocked)
+		}
+	}
+	minAlt, maxAlt := scene.AltitudeLimits(0)
+	if math.Abs(minAlt-26.5) > 0.5 || math.Abs(maxAlt-53) > 0.5 {
+		t.Errorf("AltitudeLimits(0) = (%v, %v), want about (26.5, 53)", minAlt, maxAlt)
+	}
+}
+
+func TestOverhangMaxAltitude(t *testing.T) {
+	config := testConfig
+	config.Overhang = &Overhang{Height: 100, Depth: 41, LeftExtent: 50, RightExtent: 200}
+	var overhang *Overhang
+	for _, o := range config.Obstructions() {
+		if o, ok := o.(*Overhang); ok {
+			overhang = o
+		}
+	}
+	if overhang == nil {
+		t.Fatal("expected the overhang among the obstructions")
+	}
+	// Straight out: atan((100-18)/41) = 63.4°
+	if _, maxAlt := overhang.AltitudeLimits(config.DirectAzimuth); math.Abs(maxAlt-63.43) > 0.01 {
+		t.Errorf("max altitude along the direct azimuth = %v, want 63.43", maxAlt)
+	}
+	// 60° to the left the line of sight leaves the slab at its left end:
+	// exit = min(41/cos60, 50/sin60) = 57.7, atan(82/57.7) = 54.85°
+	if _, maxAlt := overhang.AltitudeLimits(config.DirectAzimuth - 60); math.Abs(maxAlt-54.85) > 0.01 {
+		t.Errorf("max altitude 60° left = %v, want 54.85", maxAlt)
+	}
+	obstructions := config.Obstructions()
+	if lineOfSight(62, config.DirectAzimuth, obstructions).Status != ClearanceClear || lineOfSight(64, config.DirectAzimuth, obstructions).Status != ClearanceBlocked {
+		t.Errorf("expected the overhang to limit the altitude at 63.4°")
+	}
+}
+
+func TestFenceVignetting(t *testing.T) {
+	// Pivot 10 below the railing top, 35 away; 8 wide aperture without offset
+	fence := &Fence{Height: 28, WindowHeight: 100, Distance: 35, TelescopeHeight: 18, DirectAzimuth: 0, Telescope: TelescopeGeometry{ApertureDiameter: 8}}
+	edge := Rad2deg(math.Atan(10.0 / 35))
+	tests := []struct {
+		name     string
+		altitude float64
+		want     ClearanceStatus
+		percent  float64
+		report   string
+	}{
+		{"well above the railing", edge + 20, ClearanceClear, 0, "fully clear"},
+		{"axis on the railing edge", edge, ClearanceVignetted, 50, "partially vignetted (50.0%)"},
+		{"well below the railing", edge - 20, ClearanceBlocked, 100, "blocked"},
+	}
+	for _, tt := range tests {
+		got := lineOfSight(tt.altitude, 0, []Obstruction{fence})
+		if got.Status != tt.want || math.Abs(got.VignettedPercent-tt.percent) > 1e-6 || got.String() != tt.report {
+			t.Errorf("%s: got %+v (%s), want %s %.0f%%", tt.name, got, got, tt.want, tt.percent)
+		}
+	}
+
+	// Raising the objective on a pivot offset clears the railing earlier
+	fence.Telescope.PivotOffset = 10
+	if got := lineOfSight(edge, 0, []Obstruction{fence}); got.VignettedPercent >= 50 {
+		t.Errorf("expected the pivot offset to reduce vignetting, got %+v", got)
+	}
+
+	// 0 rejects any vignetting, 100 accepts everything but blocked steps
+	heavy := Clearance{Status: ClearanceVignetted, VignettedPercent: 99}
+	if isVisible(heavy, &Filter{}) || isVisible(heavy, &Filter{MaxVignettingPercent: DefaultMaxVignettingPercent}) {
+		t.Errorf("expected a 99%% vignetted step to be rejected by default")
+	}
+	if !isVisible(heavy, &Filter{MaxVignettingPercent: 100}) || isVisible(Clearance{Status: ClearanceBlocked, VignettedPercent: 100}, &Filter{MaxVignettingPercent: 100}) {
+		t.Errorf("expected 100%% to accept vignetted but not blocked steps")
+	}
+	if !isVisible(Clearance{Status: ClearanceClear}, &Filter{}) {
+		t.Errorf("expected a clear step to be visible")
+	}
+}
+
+func TestMountProfiles(t *testing.T) {
+	configs := ConfigArray{
+		Configs: []Config{
+			{Mount: "refractor"},
+			{Mount: "seestar-s50"},
+			{},
+			{Mount: "unknown"},
+		},
+		Mounts: []MountProfile{{Name: "refractor", MinAltitude: 25, MaxAltitude: 88, Tracking: TrackingEquatorial}},
+	}
+	if err := configs.ResolveMounts(); err == nil {
+		t.Fatal("expected an error for the unknown mount profile")
+	}
+	configs.Configs = configs.Configs[:3]
+	if err := configs.ResolveMounts(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		config   *Config
+		min, max float64
+	}{
+		{&configs.Configs[0], 25, 88},
+		{&configs.Configs[1], 10, 85}, // zenith hole of 5°
+		{&configs.Configs[2], minObservableAltitude, maxObservableAltitude},
+	}
+	for _, tt := range tests {
+		profile := tt.config.MountProfile()
+		r := profile.altitudeRange()
+		if r.Min != tt.min || r.Max != tt.max {
+			t.Errorf("mount %q: altitude range [%v, %v], want [%v, %v]", tt.config.Mount, r.Min, r.Max, tt.min, tt.max)
+		}
+	}
+}
+
+func TestMeridianFlipSplitsWindow(t *testing.T) {
+	// Object transiting the meridian high in the south, seen through an
+	// opening facing south
+	object := m31
+	config := Config{
+		Position: testConfig.Position,
+		Mount:    "eq",
+	}
+	timeRanges := []TimeRange{{
+		StartTime: time.Date(2025, 10, 20, 4, 0, 0, 0, time.UTC),
+		EndTime:   time.Date(2025, 10, 20, 12, 0, 0, 0, time.UTC),
+	}}
+	objects := &AstroObjectArray{Objects: []AstroObject{object}}
+
+	infos := CalculateAltitudeVisibility(objects, &ConfigArray{Configs: []Config{config}}, timeRanges, 5, Filter{}, true)
+	if len(infos) != 1 || len(infos[0].VisibilityWindows) != 2 {
+		t.Fatalf("expected the window to be split in two at the flip, got %+v", infos)
+	}
+	before, after := infos[0].VisibilityWindows[0], infos[0].VisibilityWindows[1]
+	if before.PierSide != PierSideWest || after.PierSide != PierSideEast {
+		t.Errorf("expected west then east pier side, got %s then %s", before.PierSide, after.PierSide)
+	}
+	if before.FlipTime == nil || after.FlipTime == nil || !before.FlipTime.Equal(after.StartTime) {
+		t.Errorf("expected both segments to be marked with the flip time")
+	}
+
+	// Without room for the flipped tube only the pre-flip segment remains
+	config.PierSides = []PierSide{PierSideWest}
+	infos = CalculateAltitudeVisibility(objects, &ConfigArray{Configs: []Config{config}}, timeRanges, 5, Filter{}, true)
+	if len(infos) != 1 || len(infos[0].VisibilityWindows) != 1 || infos[0].VisibilityWindows[0].PierSide != PierSideWest {
+		t.Errorf("expected only the west pier side window, got %+v", infos)
+	}
+
+	// An alt-az config overlaps the west pier side window from 04:00 to
+	// 06:10 and is blocked near the zenith until 07:45; the overlap counts
+	// once
+	altaz := Config{Position: config.Position}
+	infos = CalculateAltitudeVisibility(objects, &ConfigArray{Configs: []Config{config, altaz}}, timeRanges, 5, Filter{}, true)
+	if len(infos) != 1 || len(infos[0].VisibilityWindows) != 3 {
+		t.Fatalf("expected the west pier side and two alt-az windows, got %+v", infos)
+	}
+	if want := 7*time.Hour + 10*time.Minute; infos[0].TotalDuration != want {
+		t.Errorf("expected the overlap to be counted once, got %s, want %s", infos[0].TotalDuration, want)
+	}
+	if nights := GroupByNight(infos, timeRanges); nights[0].TotalDuration != infos[0].TotalDuration || nights[0].Nights[0].TotalDuration != infos[0].TotalDuration {
+		t.Errorf("expected the nightly total to count the overlap once, got %s", nights[0].TotalDuration)
+	}
+}
+
+func TestFieldRotation(t *testing.T) {
+	// Due north or south at the altitude equal to the latitude the field
+	// rotates at the sidereal rate
+	if rate := fieldRotationRate(45, 45, 0); math.Abs(rate-siderealRate) > 1e-12 {
+		t.Errorf("rate = %v, want %v", rate, siderealRate)
+	}
+	if rate := fieldRotationRate(45, 30, 90); math.Abs(rate) > 1e-12 {
+		t.Errorf("rate due east = %v, want 0", rate)
+	}
+	// 1 px at a corner 2000 px from the center
+	options := FieldRotationOptions{SensorWidthPx: 3200, SensorHeightPx: 2400, TolerancePx: 1}
+	seconds := 1 / (2000 * siderealRate)
+	want := time.Duration(seconds * float64(time.Second))
+	if got := options.maxSubExposure(siderealRate); got != want {
+		t.Errorf("maxSubExposure = %v, want %v", got, want)
+	}
+
+	// Windows of configs at different positions are kept apart and analyzed
+	// at their own position
+	configs, infos := twoPositionWindows(t)
+	AnalyzeFieldRotation(infos, configs, options)
+	alone := analyzedAlone(infos[0], configs, func(infos []VisibilityInfo, configs *ConfigArray) {
+		AnalyzeFieldRotation(infos, configs, options)
+	})
+	for i, window := range infos[0].VisibilityWindows {
+		if window.FieldRotation.MaxRateDegPerMinute != alone[i].FieldRotation.MaxRateDegPerMinute {
+			t.Errorf("config %d: rate %v, want %v", window.ConfigIndex, window.FieldRotation.MaxRateDegPerMinute, alone[i].FieldRotation.MaxRateDegPerMinute)
+		}
+	}
+}
+
+// twoPositionWindows returns the windows of M31 seen from two alt-az configs
+// at different positions during the same hours
+func twoPositionWindows(t *testing.T) (*ConfigArray, []VisibilityInfo) {
+	t.Helper()
+	configs := &ConfigArray{Configs: []Config{
+		{Position: Position{Latitude: 47.6, Longitude: -122.33}},
+		{Position: testConfig.Position},
+	}}
+	timeRanges := []TimeRange{{StartTime: time.Date(2025, 11, 5, 4, 0, 0, 0, time.UTC), EndTime: time.Date(2025, 11, 5, 6, 0, 0, 0, time.UTC)}}
+	infos := CalculateAltitudeVisibility(&AstroObjectArray{Objects: []AstroObject{m31}}, configs, timeRanges, 5, Filter{}, true)
+	if len(infos) != 1 || len(infos[0].VisibilityWindows) != 2 || infos[0].VisibilityWindows[0].ConfigIndex == infos[0].VisibilityWindows[1].ConfigIndex {
+		t.Fatalf("expected one window per position, got %+v", infos)
+	}
+	return configs, infos
+}
+
+// analyzedAlone runs the analysis on every window of the object with only
+// the window's own config
+func analyzedAlone(info VisibilityInfo, configs *ConfigArray, analyze func([]VisibilityInfo, *ConfigArray)) []VisibilityWindow {
+	var windows []VisibilityWindow
+	for _, window := range info.VisibilityWindows {
+		single := &ConfigArray{Configs: []Config{configs.Configs[window.ConfigIndex]}}
+		window.ConfigIndex = 0
+		alone := []VisibilityInfo{{Object: info.Object, VisibilityWindows: []VisibilityWindow{window}}}
+		analyze(alone, single)
+		windows = append(windows, alone[0].VisibilityWindows[0])
+	}
+	return windows
+}
+
+func TestFraming(t *testing.T) {
+	config := &ConfigArray{}
+	equipment, err := config.FindEquipment("seestar-s50")
+	if err != nil {
+		t.Fatal(err)
+	}
+	width, height := equipment.FieldOfView()
+	if math.Abs(width-76.5) > 0.5 || math.Abs(height-43.1) > 0.5 {
+		t.Errorf("field of view = %.1f' x %.1f', want 76.5' x 43.1'", width, height)
+	}
+
+	options := FramingOptions{Equipment: equipment}
+	// A 60' x 10' object lying east-west fits, turned north-south it does not
+	object := AstroObject{MajorAxis: 60, MinorAxis: 10, PositionAngle: 90}
+	framing, ok := options.Frame(object)
+	if !ok || framing.NeedsMosaic {
+		t.Errorf("east-west framing = %+v, want a fit", framing)
+	}
+	object.PositionAngle = 0
+	if framing, _ = options.Frame(object); !framing.NeedsMosaic {
+		t.Errorf("north-south framing = %+v, want a mosaic", framing)
+	}
+	options.Rotation = 90
+	if framing, _ = options.Frame(object); framing.NeedsMosaic {
+		t.Errorf("rotated framing = %+v, want a fit", framing)
+	}
+
+	if _, err := config.FindEquipment("unknown"); err == nil {
+		t.Error("expected an error for an unknown equipment profile")
+	}
+}
+
+func TestPlanMosaic(t *testing.T) {
+	config := &ConfigArray{}
+	equipment, _ := config.FindEquipment("seestar-s50")
+	options := FramingOptions{Equipment: equipment}
+	object := AstroObject{
+		Name:          "wide",
+		Ra:            RightAscension{Hour: 20, Min: 58},
+		Dec:           Declination{Degree: 44, Min: 20},
+		MajorAxis:     150,
+		MinorAxis:     40,
+		PositionAngle: 90,
+	}
+	mosaic := PlanMosaic(object, options, 0.15)
+	if mosaic.Columns != 3 || mosaic.Rows != 1 || len(mosaic.Panels) != 3 {
+		t.Fatalf("got %dx%d panels (%d), want 3x1", mosaic.Columns, mosaic.Rows, len(mosaic.Panels))
+	}
+	center := spatial.Point{RA: object.Ra.toDegree(), Dec: object.Dec.toDegree()}
+	middle := mosaic.Panels[1].Object
+	if sep := spatial.Separation(center, spatial.Point{RA: middle.Ra.toDegree(), Dec: middle.Dec.toDegree()}); sep > 1e-9 {
+		t.Errorf("middle panel is %v° off the center", sep)
+	}
+	width, _ := equipment.FieldOfView()
+	right := mosaic.Panels[2].Object
+	p := spatial.Point{RA: right.Ra.toDegree(), Dec: right.Dec.toDegree()}
+	if sep := spatial.Separation(center, p); math.Abs(sep-width*0.85/60) > 1e-9 {
+		t.Errorf("panel step = %v°, want %v°", sep, width*0.85/60)
+	}
+	if pa := spatial.PositionAngle(center, p); math.Abs(pa-90) > 1e-6 {
+		t.Errorf("right panel position angle = %v, want 90", pa)
+	}
+
+	objects := &AstroObjectArray{Objects: []AstroObject{object}}
+	for _, overlap := range []float64{-0.1, 1, 1.5} {
+		if _, _, err := SplitMosaics(objects, options, overlap); err == nil {
+			t.Errorf("expected an error for overlap %v", overlap)
+		}
+	}
+	if _, mosaics, err := SplitMosaics(objects, options, 0); err != nil || len(mosaics) != 1 || len(mosaics[0].Panels) != 2 {
+		t.Errorf("expected a 2 panel mosaic without overlap, got %+v, %v", mosaics, err)
+	}
+	if got := panelCount(120, 60, 0); got != 1 {
+		t.Errorf("panelCount without a step = %d, want 1", got)
+	}
+}
+
+func TestClearPercent(t *testing.T) {
+	object := AstroObject{Ra: RightAscension{Hour: 20, Min: 58}, Dec: Declination{Degree: 44, Min: 20}, MajorAxis: 120, MinorAxis: 100}
+	position := &testConfig.Position
+	when := time.Date(2025, 7, 31, 6, 0, 0, 0, time.UTC)
+	alt, _ := radecToAltAz(object, position, when)
+
+	if samples := extentSamples(object, &Filter{}); samples != nil {
+		t.Errorf("expected no samples without MinClearPercent, got %d", len(samples))
+	}
+	samples := extentSamples(object, &Filter{MinClearPercent: 90})
+	if got := clearPercent(samples, position, when, []Obstruction{&AltitudeRange{Min: alt - 2, Max: 90}}); got != 100 {
+		t.Errorf("clear = %v%%, want 100%%", got)
+	}
+	// The lower half of the object is below the fence
+	got := clearPercent(samples, position, when, []Obstruction{&AltitudeRange{Min: alt, Max: 90}})
+	if got < 40 || got > 70 {
+		t.Errorf("clear = %v%%, want about half", got)
+	}
+
+	// The clear part counts also when the center is just below the horizon
+	config := Config{Position: *position, HorizonMask: HorizonMask{{Azimuth: 0, MinAltitude: alt + 0.2}}}
+	clear := clearPercent(samples, position, when, config.Obstructions())
+	if clear <= 0 || clear >= 50 {
+		t.Fatalf("clear = %v%%, want less than half", clear)
+	}
+	objects := &AstroObjectArray{Objects: []AstroObject{object}}
+	configs := &ConfigArray{Configs: []Config{config}}
+	timeRanges := []TimeRange{{StartTime: when, EndTime: when.Add(time.Minute)}}
+	if infos := CalculateAltitudeVisibility(objects, configs, timeRanges, 5, Filter{MinClearPercent: clear - 1}, true); len(infos) != 1 {
+		t.Errorf("expected the object to be visible with %.0f%% clear", clear)
+	}
+	if infos := CalculateAltitudeVisibility(objects, configs, timeRanges, 5, Filter{MinClearPercent: clear + 1}, true); len(infos) != 0 {
+		t.Errorf("expected the object to be hidden with less than %.0f%% clear", clear+1)
+	}
+}
+
+func TestSites(t *testing.T) {
+	configs := ConfigArray{
+		Sites:   []Site{{Name: "home", Latitude: 37.38, Longitude: -121.89, Timezone: "America/Los_Angeles"}},
+		Configs: []Config{{Site: "home"}},
+	}
+	if err := configs.ResolveSites(); err != nil {
+		t.Fatal(err)
+	}
+	if configs.Configs[0].Position.Latitude != 37.38 {
+		t.Errorf("position not taken from the site: %+v", configs.Configs[0].Position)
+	}
+
+	// Local times follow daylight saving time of the site
+	summer, err := ParseTime("2025-07-30T22:00:00", configs.Location())
+	if err != nil {
+		t.Fatal(err)
+	}
+	winter, _ := ParseTime("2025-12-30T22:00:00", configs.Location())
+	if _, offset := summer.Zone(); offset != -7*3600 {
+		t.Errorf("summer offset = %d, want -7h", offset)
+	}
+	if _, offset := winter.Zone(); offset != -8*3600 {
+		t.Errorf("winter offset = %d, want -8h", offset)
+	}
+	if _, err := ParseTime("2025-07-30T22:00:00", nil); err == nil {
+		t.Error("expected an error for a local time without a site")
+	}
+
+	// Dark time is planned at the site, also when it is not the first config
+	configs.Configs = append([]Config{{Position: Position{Latitude: -33.9, Longitude: 18.4}}}, configs.Configs...)
+	if err := configs.ResolveSites(); err != nil {
+		t.Fatal(err)
+	}
+	date := time.Date(2025, 7, 30, 0, 0, 0, 0, time.UTC)
+	timeRanges, err := configs.DarkTimeRanges(date, date, ephemeris.DarknessAstronomical)
+	if err != nil || len(timeRanges) != 1 || timeRanges[0].StartTime.Hour() != 22 {
+		t.Errorf("dark time %+v (%v), want it from 22:00 in San Jose", timeRanges, err)
+	}
+
+	configs.Sites[0].Timezone = "Mars/Olympus_Mons"
+	if err := configs.ResolveSites(); err == nil {
+		t.Error("expected an error for an unknown timezone")
+	}
+	configs.Sites[0].Timezone = ""
+	if err := configs.ResolveSites(); err == nil {
+		t.Error("expected an error for a site without a timezone")
+	}
+}
+
+func TestMoonAvoidance(t *testing.T) {
+	avoidance := MoonAvoidance{Separation: 120, Width: 14}
+	if got := avoidance.requiredSeparation(ephemeris.SynodicMonth / 2); math.Abs(got-120) > 1e-9 {
+		t.Errorf("separation at full moon = %v, want 120", got)
+	}
+	if got := avoidance.requiredSeparation(0); got > 60 {
+		t.Errorf("separation at new moon = %v, want well below 120", got)
+	}
+	if !avoidance.allows(moonState{altitude: -5, separation: 10, age: 15}) {
+		t.Error("a Moon below the horizon should not constrain")
+	}
+	if avoidance.allows(moonState{altitude: 20, separation: 100, age: 15}) {
+		t.Error("100° from the full Moon should be rejected")
+	}
+
+	// The Moon of every window is seen from the window's own config
+	configs, infos := twoPositionWindows(t)
+	AnalyzeMoon(infos, configs, nil)
+	alone := analyzedAlone(infos[0], configs, func(infos []VisibilityInfo, configs *ConfigArray) {
+		AnalyzeMoon(infos, configs, nil)
+	})
+	for i, window := range infos[0].VisibilityWindows {
+		if *window.Moon != *alone[i].Moon {
+			t.Errorf("config %d: moon %+v, want %+v", window.ConfigIndex, *window.Moon, *alone[i].Moon)
+		}
+	}
+}
+
+func TestSkyBrightness(t *testing.T) {
+	noMoon := moonState{altitude: -10}
+	if got := skyBrightness(21.9, 90, -30, noMoon); math.Abs(got-21.9) > 1e-6 {
+		t.Errorf("dark zenith sky = %v, want 21.9", got)
+	}
+	low := skyBrightness(21.9, 25, -30, noMoon)
+	if low >= 21.9 {
+		t.Errorf("sky at 25° = %v, want brighter than the zenith", low)
+	}
+	fullMoon := moonState{altitude: 40, illumination: 1, separation: 60}
+	if got := skyBrightness(21.9, 60, -30, fullMoon); got > 19.5 {
+		t.Errorf("sky near the full Moon = %v, want much brighter", got)
+	}
+	if got := skyBrightness(21.9, 60, -9, noMoon); got > 17 {
+		t.Errorf("sky in nautical twilight = %v, want much brighter", got)
+	}
+	if got := limitingMagnitude(21.9); got < 6 || got > 7 {
+		t.Errorf("limiting magnitude under a dark sky = %v", got)
+	}
+
+	infos := []VisibilityInfo{
+		{Object: AstroObject{Name: "bright", SurfaceBrightness: 20}, VisibilityWindows: []VisibilityWindow{{Sky: &SkyBrightness{Samples: []SkySample{{}}, Darkest: 19}}}},
+		{Object: AstroObject{Name: "faint", SurfaceBrightness: 23}, VisibilityWindows: []VisibilityWindow{{Sky: &SkyBrightness{Samples: []SkySample{{}}, Darkest: 19}}}},
+		{Object: AstroObject{Name: "unknown"}},
+	}
+	kept := FilterBySurfaceBrightness(infos, 2)
+	if len(kept) != 2 || kept[0].Object.Name != "bright" || kept[1].Object.Name != "unknown" {
+		t.Errorf("kept %+v", kept)
+	}
+
+	// Every window uses the position and sky quality of its own config
+	configs, infos := twoPositionWindows(t)
+	configs.Configs[1].site = &Site{Name: "dark", SQM: 21.8}
+	AnalyzeSkyBrightness(infos, configs)
+	alone := analyzedAlone(infos[0], configs, AnalyzeSkyBrightness)
+	for i, window := range infos[0].VisibilityWindows {
+		if window.Sky.Darkest != alone[i].Sky.Darkest || window.Sky.Brightest != alone[i].Sky.Brightest {
+			t.Errorf("config %d: sky %v to %v, want %v to %v", window.ConfigIndex, window.Sky.Brightest, window.Sky.Darkest, alone[i].Sky.Brightest, alone[i].Sky.Darkest)
+		}
+	}
+}
+
+func TestAirmass(t *testing.T) {
+	for _, tc := range []struct{ altitude, want float64 }{{90, 1}, {30, 1.995}, {0, 37.92}} {
+		if got := Airmass(tc.altitude); math.Abs(got-tc.want) > 0.01 {
+			t.Errorf("Airmass(%v) = %v, want %v", tc.altitude, got, tc.want)
+		}
+	}
+
+	timeRanges := []TimeRange{{
+		StartTime: time.Date(2025, 10, 20, 2, 0, 0, 0, time.UTC),
+		EndTime:   time.Date(2025, 10, 20, 12, 0, 0, 0, time.UTC),
+	}}
+	objects := &AstroObjectArray{Objects: []AstroObject{m31}}
+	configs := &ConfigArray{Configs: []Config{{Position: testConfig.Position}}}
+
+	infos := CalculateAltitudeVisibility(objects, configs, timeRanges, 5, Filter{}, true)
+	if len(infos) != 1 || len(infos[0].VisibilityWindows) == 0 {
+		t.Fatalf("expected a window, got %+v", infos)
+	}
+	// The rising object is highest at the end of the first window
+	window := infos[0].VisibilityWindows[0]
+	if window.PeakAlt <= window.StartAlt || !window.PeakTime.After(window.StartTime) || window.PeakTime.After(window.EndTime) {
+		t.Errorf("peak %v° at %s outside the window %+v", window.PeakAlt, window.PeakTime, window)
+	}
+	if window.MinAirmass != Airmass(window.PeakAlt) || window.MaxAirmass != Airmass(window.StartAlt) {
+		t.Errorf("airmass %v to %v, want the airmass at the peak and at the start", window.MinAirmass, window.MaxAirmass)
+	}
+
+	limited := CalculateAltitudeVisibility(objects, configs, timeRanges, 5, Filter{MaxAirmass: 1.5}, true)
+	if len(limited) != 1 || limited[0].TotalDuration >= infos[0].TotalDuration || limited[0].VisibilityWindows[0].MaxAirmass > 1.5 {
+		t.Errorf("expected a shorter window below airmass 1.5, got %+v", limited)
+	}
+
+	if err := AnalyzeExtinction(limited, "v"); err != nil {
+		t.Fatal(err)
+	}
+	if extinction := limited[0].VisibilityWindows[0].Extinction; extinction == nil || extinction.Band != "V" || extinction.Max > 0.3 {
+		t.Errorf("extinction %+v", extinction)
+	}
+	if err := AnalyzeExtinction(limited, "X"); err == nil {
+		t.Error("expected an error for an unknown band")
+	}
+
+	// Near the pole the azimuth swings back and forth across north: within
+	// asin(cos 80° / cos 37.38°) = 12.6° of it over a whole day
+	polar := AstroObject{Name: "polar", Ra: RightAscension{Hour: 2}, Dec: Declination{Degree: 80}}
+	day := []TimeRange{{StartTime: timeRanges[0].StartTime, EndTime: timeRanges[0].StartTime.Add(24 * time.Hour)}}
+	infos = CalculateAltitudeVisibility(&AstroObjectArray{Objects: []AstroObject{polar}}, configs, day, 5, Filter{}, true)
+	if len(infos) != 1 || len(infos[0].VisibilityWindows) != 1 {
+		t.Fatalf("expected a single window, got %+v", infos)
+	}
+	if window := infos[0].VisibilityWindows[0]; math.Abs(window.MinAz-347.4) > 0.2 || math.Abs(window.MaxAz-12.6) > 0.2 {
+		t.Errorf("azimuth range %.1f° to %.1f°, want 347.4° to 12.6°", window.MinAz, window.MaxAz)
+	}
+
+	window = VisibilityWindow{MinAz: 350, MaxAz: 10}
+	window.widenAzimuth(30, 40)
+	if window.MinAz != 350 || window.MaxAz != 40 {
+		t.Errorf("widened range %v° to %v°, want 350° to 40°", window.MinAz, window.MaxAz)
+	}
+	window.widenAzimuth(100, 300)
+	if window.MinAz != 100 || window.MaxAz != 40 {
+		t.Errorf("widened range %v° to %v°, want 100° to 40°", window.MinAz, window.MaxAz)
+	}
+	window.widenAzimuth(40, 100)
+	if window.MinAz != 0 || window.MaxAz != 360 {
+		t.Errorf("widened range %v° to %v°, want the full circle", window.MinAz, window.MaxAz)
+	}
+}
+
+func TestRankByScore(t *testing.T) {
+	start := time.Date(2025, 7, 31, 6, 0, 0, 0, time.UTC)
+	timeRanges := []TimeRange{{StartTime: start, EndTime: start.Add(4 * time.Hour)}}
+	window := func(hours time.Duration, peak float64) []VisibilityWindow {
+		return []VisibilityWindow{{StartTime: start, EndTime: start.Add(hours * time.Hour), PeakAlt: peak, PeakTime: start}}
+	}
+	infos := []VisibilityInfo{
+		{Object: AstroObject{Name: "short"}, VisibilityWindows: window(1, 40), TotalDuration: time.Hour},
+		{Object: AstroObject{Name: "Andromeda Galaxy (NGC0224)"}, VisibilityWindows: window(2, 60), TotalDuration: 2 * time.Hour},
+		{Object: AstroObject{Name: "long"}, VisibilityWindows: window(4, 80), TotalDuration: 4 * time.Hour},
+	}
+	options := ScoreOptions{Weights: DefaultScoreWeights, Configs: &ConfigArray{Configs: []Config{{Position: testConfig.Position}}}}
+	RankByScore(infos, timeRanges, options)
+	if infos[0].Object.Name != "long" || infos[2].Object.Name != "short" {
+		t.Errorf("expected the longest and highest object first, got %s, %s, %s", infos[0].Object.Name, infos[1].Object.Name, infos[2].Object.Name)
+	}
+	if score := infos[0].Score; score.Duration != 1 || score.Priority != nil || score.Total <= infos[1].Score.Total {
+		t.Errorf("score %+v", score)
+	}
+
+	// A high priority outweighs the rest when priority dominates
+	options.Weights = ScoreWeights{Duration: 1, Priority: 10}
+	options.Priorities = map[string]float64{"NGC0224": 10}
+	RankByScore(infos, timeRanges, options)
+	if infos[0].Object.Name != "Andromeda Galaxy (NGC0224)" || *infos[0].Score.Priority != 1 {
+		t.Errorf("expected the prioritized object first, got %s", infos[0].Object.Name)
+	}
+	if got := priorityOf(map[string]float64{"Andromeda Galaxy": 4}, "Andromeda Galaxy,M31 (NGC0224)"); got != 4 {
+		t.Errorf("priority by common name = %v", got)
+	}
+
+	if page := Paginate(infos, 2, 2); len(page) != 1 || page[0].Object.Name != infos[2].Object.Name {
+		t.Errorf("second page %+v", page)
+	}
+	if page := Paginate(infos, 2, 3); len(page) != 0 {
+		t.Errorf("expected an empty third page, got %+v", page)
+	}
+
+	if err := (&ScoreWeights{Duration: 1, Altitude: -1}).Validate(); err == nil {
+		t.Error("expected an error for a negative weight")
+	}
+	if err := (&ScoreWeights{}).Validate(); err == nil {
+		t.Error("expected an error for weights adding up to 0")
+	}
+	if err := DefaultScoreWeights.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	// A partial scoring section overrides only the weights it sets
+	var partial ConfigArray
+	if err := json.Unmarshal([]byte(`{"scoring":{"priority":3,"fill":0}}`), &partial); err != nil {
+		t.Fatal(err)
+	}
+	want := DefaultScoreWeights
+	want.Priority, want.Fill = 3, 0
+	if *partial.Scoring != want {
+		t.Errorf("scoring %+v, want %+v", *partial.Scoring, want)
+	}
+
+	// The sky is scored at the site of the config of the highest window
+	configs, two := twoPositionWindows(t)
+	configs.Configs[1].site = &Site{Name: "dark", SQM: 21.8}
+	two[0].Object.SurfaceBrightness = 18
+	best := &two[0].VisibilityWindows[1]
+	best.PeakAlt = 85
+	RankByScore(two, timeRanges, ScoreOptions{Weights: DefaultScoreWeights, Configs: configs})
+	single := &ConfigArray{Configs: []Config{configs.Configs[best.ConfigIndex]}}
+	alone := []VisibilityInfo{{Object: two[0].Object, VisibilityWindows: []VisibilityWindow{*best}, TotalDuration: two[0].TotalDuration}}
+	alone[0].VisibilityWindows[0].ConfigIndex = 0
+	RankByScore(alone, timeRanges, ScoreOptions{Weights: DefaultScoreWeights, Configs: single})
+	if *two[0].Score.SurfaceBrightness != *alone[0].Score.SurfaceBrightness {
+		t.Errorf("surface brightness score %v, want %v from the config of the highest window", *two[0].Score.SurfaceBrightness, *alone[0].Score.SurfaceBrightness)
+	}
+}
+
+func TestGroupByNight(t *testing.T) {
+	night := func(day int) TimeRange {
+		start := time.Date(2025, 9, day, 4, 0, 0, 0, time.UTC)
+		return TimeRange{StartTime: start, EndTime: start.Add(8 * time.Hour)}
+	}
+	window := func(day, hour int, peak float64) VisibilityWindow {
+		start := time.Date(2025, 9, day, hour, 0, 0, 0, time.UTC)
+		return VisibilityWindow{StartTime: start, EndTime: start.Add(time.Hour), PeakAlt: peak, PeakTime: start}
+	}
+	timeRanges := []TimeRange{night(1), night(2), night(3)}
+	infos := []VisibilityInfo{{
+		Object:            AstroObject{Name: "M33"},
+		VisibilityWindows: []VisibilityWindow{window(1, 5, 40), window(1, 8, 50), window(3, 6, 60)},
+	}}
+
+	nightly := GroupByNight(infos, timeRanges)
+	if len(nightly) != 1 || len(nightly[0].Nights) != 3 {
+		t.Fatalf("expected three nights for one object, got %+v", nightly)
+	}
+	plan := nightly[0]
+	if plan.TotalDuration != 3*time.Hour || plan.VisibleNights != 2 {
+		t.Errorf("total %s on %d nights, want 3h on 2 nights", plan.TotalDuration, plan.VisibleNights)
+	}
+	if first := plan.Nights[0]; len(first.VisibilityWindows) != 2 || first.TotalDuration != 2*time.Hour || first.PeakAlt != 50 {
+		t.Errorf("first night %+v", first)
+	}
+	if plan.Nights[1].PeakTime != nil {
+		t.Errorf("expected no peak in the second night")
+	}
+	if best := plan.HighestNights(1); len(best) != 1 || !best[0].Night.StartTime.Equal(night(3).StartTime) {
+		t.Errorf("highest night %+v", best)
+	}
+}